@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestArchiveHandler(t *testing.T) {
+	origStore := store
+	t.Cleanup(func() { store = origStore })
+	store = db.NewMemoryStore()
+
+	ctx := context.Background()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, sn := range []struct {
+		story types.Story
+		rank  int
+		at    time.Time
+	}{
+		{types.Story{ID: 1, Title: "Climbing", Score: 50}, 3, day.Add(time.Hour)},
+		{types.Story{ID: 1, Title: "Climbing", Score: 120}, 1, day.Add(5 * time.Hour)},
+		{types.Story{ID: 2, Title: "Next day", Score: 80}, 2, day.AddDate(0, 0, 1).Add(time.Hour)},
+	} {
+		if err := store.UpsertStory(ctx, sn.story); err != nil {
+			t.Fatalf("upsert story: %v", err)
+		}
+		if err := store.RecordSnapshot(ctx, sn.story, sn.rank, sn.at); err != nil {
+			t.Fatalf("record snapshot: %v", err)
+		}
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		archiveHandler(rec, httptest.NewRequest(http.MethodGet, "/api/archive?"+query, nil))
+		return rec
+	}
+
+	rec := get("date=2024-03-01")
+	var single ArchiveDay
+	if err := json.NewDecoder(rec.Body).Decode(&single); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("single day: status %d, %v", rec.Code, err)
+	}
+	if single.Date != "2024-03-01" || len(single.Stories) != 1 {
+		t.Fatalf("expected one story on 2024-03-01, got %+v", single)
+	}
+	if s := single.Stories[0]; s.ID != 1 || s.PeakPoints != 120 || s.BestRank != 1 || s.Appearances != 2 {
+		t.Errorf("expected the story's best showing that day, got %+v", s)
+	}
+
+	rec = get("from=2024-03-01&to=2024-03-03")
+	var rng struct {
+		From string       `json:"from"`
+		To   string       `json:"to"`
+		Days []ArchiveDay `json:"days"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&rng); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("range: status %d, %v", rec.Code, err)
+	}
+	if len(rng.Days) != 3 || rng.Days[1].Stories[0].ID != 2 || rng.Days[2].Stories == nil || len(rng.Days[2].Stories) != 0 {
+		t.Errorf("expected every day of the range, empty ones included, got %+v", rng.Days)
+	}
+
+	for _, tt := range []struct {
+		query string
+		code  string
+	}{
+		{"", "invalid_date"},
+		{"date=01/03/2024", "invalid_date"},
+		{"from=2024-03-01", "invalid_date"},
+		{"from=2024-03-02&to=2024-03-01", "invalid_range"},
+		{"from=2024-03-01&to=2024-04-01", "range_too_large"},
+	} {
+		rec := get(tt.query)
+		var resp ErrorResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusBadRequest || resp.Code != tt.code {
+			t.Errorf("%q: expected 400 %s, got %d %s", tt.query, tt.code, rec.Code, resp.Code)
+		}
+	}
+
+	if rec := get("from=2024-03-01&to=2024-03-31"); rec.Code != http.StatusOK {
+		t.Errorf("expected a 31-day range to be allowed, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/logging"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBackupDir       = "./data/backups"
+	defaultBackupRetention = 7
+)
+
+// backuper is implemented by stores that can write an online backup; only
+// the SQLite store does.
+type backuper interface {
+	Backup(ctx context.Context, dir string) (db.BackupFile, error)
+}
+
+// backupConfig is read from the environment:
+//
+//	BACKUP_DIR        where backups are written (default ./data/backups)
+//	BACKUP_INTERVAL   enables scheduled backups, e.g. "24h"
+//	BACKUP_RETENTION  number of backups to keep (default 7)
+type backupConfig struct {
+	Dir       string
+	Interval  time.Duration
+	Retention int
+}
+
+func backupConfigFromEnv() (backupConfig, error) {
+	cfg := backupConfig{
+		Dir:       os.Getenv("BACKUP_DIR"),
+		Retention: defaultBackupRetention,
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = defaultBackupDir
+	}
+
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < time.Minute {
+			return cfg, fmt.Errorf("BACKUP_INTERVAL must be a duration of at least 1m, got %q", v)
+		}
+		cfg.Interval = interval
+	}
+
+	if v := os.Getenv("BACKUP_RETENTION"); v != "" {
+		retention, err := strconv.Atoi(v)
+		if err != nil || retention < 1 {
+			return cfg, fmt.Errorf("BACKUP_RETENTION must be a positive integer, got %q", v)
+		}
+		cfg.Retention = retention
+	}
+
+	return cfg, nil
+}
+
+// runBackup writes a backup of s into cfg.Dir and prunes backups beyond the
+// retention count. It returns the new backup and the paths that were pruned.
+func runBackup(ctx context.Context, s db.Store, cfg backupConfig) (db.BackupFile, []string, error) {
+	b, ok := s.(backuper)
+	if !ok {
+		return db.BackupFile{}, nil, db.ErrBackupUnsupported
+	}
+
+	backup, err := b.Backup(ctx, cfg.Dir)
+	if err != nil {
+		return db.BackupFile{}, nil, err
+	}
+
+	removed, err := db.PruneBackups(cfg.Dir, cfg.Retention)
+	if err != nil {
+		return backup, removed, fmt.Errorf("pruning old backups: %w", err)
+	}
+	return backup, removed, nil
+}
+
+func startBackupScheduler(cfg backupConfig) {
+	logger := logging.L().With(
+		"event_type", "backup_scheduler",
+		"backup_dir", cfg.Dir,
+	)
+
+	if cfg.Interval == 0 {
+		logger.Info("scheduled backups disabled",
+			"event", "backup_scheduler_disabled",
+		)
+		return
+	}
+	if _, ok := store.(backuper); !ok {
+		logger.Warn("scheduled backups not supported by this database, use pg_dump instead",
+			"event", "backup_scheduler_unsupported",
+		)
+		return
+	}
+
+	logger.Info("backup scheduler running",
+		"event", "backup_scheduler_started",
+		"interval", cfg.Interval.String(),
+		"retention", cfg.Retention,
+	)
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		for range ticker.C {
+			backup, removed, err := runBackup(context.Background(), store, cfg)
+			if err != nil {
+				logger.Error("scheduled backup failed",
+					"event", "scheduled_backup_failed",
+					"error", err,
+				)
+				continue
+			}
+			logger.Info("scheduled backup completed",
+				"event", "scheduled_backup_completed",
+				"backup_path", backup.Path,
+				"size_bytes", backup.SizeBytes,
+				"pruned", len(removed),
+			)
+		}
+	}()
+}
+
+// restoreFromEnv restores the SQLite database from RESTORE_FROM before it is
+// opened. The restored backup is recorded in a marker file next to the
+// database so leaving RESTORE_FROM set does not roll back every restart.
+func restoreFromEnv(dsn string) error {
+	backupPath := os.Getenv("RESTORE_FROM")
+	if backupPath == "" {
+		return nil
+	}
+	if db.DialectFor(dsn) != db.SQLite {
+		return errors.New("RESTORE_FROM is only supported for SQLite databases")
+	}
+
+	logger := logging.L().With(
+		"event_type", "database_operation",
+		"operation", "restore",
+		"backup_path", backupPath,
+	)
+
+	marker := dsn + ".restored-from"
+	if previous, err := os.ReadFile(marker); err == nil && strings.TrimSpace(string(previous)) == backupPath {
+		logger.Info("backup already restored, skipping",
+			"event", "restore_skipped",
+			"marker", marker,
+		)
+		return nil
+	}
+
+	if err := db.RestoreSQLite(backupPath, dsn); err != nil {
+		return err
+	}
+	return os.WriteFile(marker, []byte(backupPath+"\n"), 0o644)
+}
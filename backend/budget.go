@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/logging"
+	"os"
+	"strconv"
+	"time"
+)
+
+// budgetConfig caps what summaries may cost, read from the environment:
+//
+//	LLM_BUDGET_DAILY_USD    spend allowed per UTC day (default unlimited)
+//	LLM_BUDGET_MONTHLY_USD  spend allowed per UTC calendar month (default unlimited)
+//
+// A zero limit means no limit.
+type budgetConfig struct {
+	DailyUSD   float64
+	MonthlyUSD float64
+}
+
+func budgetConfigFromEnv() (budgetConfig, error) {
+	var cfg budgetConfig
+	for _, v := range []struct {
+		name string
+		dst  *float64
+	}{
+		{"LLM_BUDGET_DAILY_USD", &cfg.DailyUSD},
+		{"LLM_BUDGET_MONTHLY_USD", &cfg.MonthlyUSD},
+	} {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		limit, err := strconv.ParseFloat(raw, 64)
+		if err != nil || limit < 0 {
+			return cfg, fmt.Errorf("%s must be a non-negative number, got %q", v.name, raw)
+		}
+		*v.dst = limit
+	}
+	return cfg, nil
+}
+
+// checkBudgetPricing refuses a budget that could never trip: every model in
+// the chain must either report its cost, as OpenRouter does, or have a price
+// in LLM_PRICES.
+func checkBudgetPricing(cfg budgetConfig, chain []llmCandidate) error {
+	if cfg.DailyUSD == 0 && cfg.MonthlyUSD == 0 {
+		return nil
+	}
+	for _, c := range chain {
+		if !c.Provider.isOpenRouter() && c.Price == nil {
+			return fmt.Errorf("an LLM budget is set but %s:%s reports no cost; give it a price in LLM_PRICES", c.Provider.Name, c.Model)
+		}
+	}
+	return nil
+}
+
+// llmBudget is the active budget, set at startup.
+var llmBudget budgetConfig
+
+// budgetStatus is the spend so far in the current day and month.
+type budgetStatus struct {
+	SpentTodayUSD     float64
+	SpentThisMonthUSD float64
+	// Exceeded is set when either limit has been reached; ResetIn is then
+	// the time until the exhausted period rolls over.
+	Exceeded bool
+	Period   string
+	ResetIn  time.Duration
+}
+
+func usagePeriods(now time.Time) (dayStart, dayEnd, monthStart, monthEnd time.Time) {
+	now = now.UTC()
+	dayStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return dayStart, dayStart.AddDate(0, 0, 1), monthStart, monthStart.AddDate(0, 1, 0)
+}
+
+// checkBudget compares the recorded spend against cfg. The monthly limit is
+// checked first since it is the longer wait.
+func checkBudget(ctx context.Context, s db.Store, cfg budgetConfig, now time.Time) (budgetStatus, error) {
+	dayStart, dayEnd, monthStart, monthEnd := usagePeriods(now)
+
+	today, err := s.UsageTotals(ctx, dayStart, dayEnd)
+	if err != nil {
+		return budgetStatus{}, err
+	}
+	month, err := s.UsageTotals(ctx, monthStart, monthEnd)
+	if err != nil {
+		return budgetStatus{}, err
+	}
+
+	status := budgetStatus{SpentTodayUSD: today.CostUSD, SpentThisMonthUSD: month.CostUSD}
+	switch {
+	case cfg.MonthlyUSD > 0 && month.CostUSD >= cfg.MonthlyUSD:
+		status.Exceeded, status.Period, status.ResetIn = true, "monthly", monthEnd.Sub(now)
+	case cfg.DailyUSD > 0 && today.CostUSD >= cfg.DailyUSD:
+		status.Exceeded, status.Period, status.ResetIn = true, "daily", dayEnd.Sub(now)
+	}
+	return status, nil
+}
+
+// recordUsage persists the token count and cost of an LLM request made for
+// operation. Failures are logged, not returned: the response itself is fine.
+func recordUsage(ctx context.Context, storyID int, operation string, summary SummaryResponse) {
+	err := store.RecordUsage(ctx, db.UsageRecord{
+		StoryID:          storyID,
+		Operation:        operation,
+		Provider:         summary.Provider,
+		Model:            summary.Model,
+		PromptTokens:     summary.Usage.PromptTokens,
+		CompletionTokens: summary.Usage.CompletionTokens,
+		CostUSD:          summary.Usage.Cost,
+		CreatedAt:        time.Now(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("usage persist failed",
+			"event_type", "summarize",
+			"event", "usage_persist_failed",
+			"story_id", storyID,
+			"operation", operation,
+			"error", err,
+		)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckBudget(t *testing.T) {
+	s := db.NewMemoryStore()
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	s.RecordUsage(ctx, db.UsageRecord{Model: "m", CostUSD: 4, CreatedAt: now.AddDate(0, 0, -3)})
+	s.RecordUsage(ctx, db.UsageRecord{Model: "m", CostUSD: 1.5, CreatedAt: now.Add(-time.Hour)})
+
+	status, err := checkBudget(ctx, s, budgetConfig{DailyUSD: 2, MonthlyUSD: 10}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Exceeded || status.SpentTodayUSD != 1.5 || status.SpentThisMonthUSD != 5.5 {
+		t.Errorf("expected spend within budget, got %+v", status)
+	}
+
+	status, _ = checkBudget(ctx, s, budgetConfig{DailyUSD: 1.5}, now)
+	if !status.Exceeded || status.Period != "daily" || status.ResetIn != 12*time.Hour {
+		t.Errorf("expected the daily budget to be exhausted until midnight, got %+v", status)
+	}
+
+	status, _ = checkBudget(ctx, s, budgetConfig{DailyUSD: 1.5, MonthlyUSD: 5}, now)
+	if !status.Exceeded || status.Period != "monthly" || status.ResetIn != 15*24*time.Hour+12*time.Hour {
+		t.Errorf("expected the monthly budget to win, got %+v", status)
+	}
+}
+
+func TestSummarizeRespectsBudget(t *testing.T) {
+	origCache, origStore, origBudget := storyCache, store, llmBudget
+	t.Cleanup(func() { storyCache, store, llmBudget = origCache, origStore, origBudget })
+
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+	llmBudget = budgetConfig{DailyUSD: 1}
+
+	storyCache.Set(1, EnrichedStory{Story: types.Story{ID: 1, URL: "https://example.com/a"}})
+	storyCache.Set(2, EnrichedStory{Story: types.Story{ID: 2}, Summary: "Already done", SummaryModel: "m", SummaryPromptVersion: summaryPrompt.Version})
+	store.RecordUsage(context.Background(), db.UsageRecord{Model: "m", CostUSD: 1, CreatedAt: time.Now()})
+
+	rec := httptest.NewRecorder()
+	summarizeHandler(rec, httptest.NewRequest(http.MethodGet, "/api/summarize?id=1", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After once the budget is spent, got %d", rec.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Code != "budget_exceeded" {
+		t.Errorf("unexpected error body %+v %v", resp, err)
+	}
+
+	rec = httptest.NewRecorder()
+	summarizeHandler(rec, httptest.NewRequest(http.MethodGet, "/api/summarize?id=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected existing summaries to be served over budget, got %d", rec.Code)
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	origStore, origBudget := store, llmBudget
+	t.Cleanup(func() { store, llmBudget = origStore, origBudget })
+
+	store = db.NewMemoryStore()
+	llmBudget = budgetConfig{MonthlyUSD: 20}
+	day := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	store.RecordUsage(context.Background(), db.UsageRecord{Model: "a", PromptTokens: 100, CompletionTokens: 10, CostUSD: 0.25, CreatedAt: day})
+	store.RecordUsage(context.Background(), db.UsageRecord{Model: "a", PromptTokens: 300, CompletionTokens: 30, CostUSD: 0.75, CreatedAt: day.Add(time.Hour)})
+
+	rec := httptest.NewRecorder()
+	usageHandler(rec, httptest.NewRequest(http.MethodGet, "/api/admin/usage?from=2025-06-01&to=2025-06-30", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp UsageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Totals.Requests != 2 || resp.Totals.PromptTokens != 400 || resp.Totals.CostUSD != 1 {
+		t.Errorf("unexpected totals %+v", resp.Totals)
+	}
+	if len(resp.Days) != 1 || resp.Days[0].Date != "2025-06-01" || resp.Budget.MonthlyUSD != 20 {
+		t.Errorf("unexpected report %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	usageHandler(rec, httptest.NewRequest(http.MethodGet, "/api/admin/usage?from=2025-06-30&to=2025-06-01", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an inverted range to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestCheckBudgetPricing(t *testing.T) {
+	t.Setenv("LLM_PROVIDER_LOCAL_BASE_URL", "http://localhost:11434/v1")
+	chain := mustParseLLMChain("openrouter:@preset/hn30-summary,local:llama3.1")
+
+	if err := checkBudgetPricing(budgetConfig{}, chain); err != nil {
+		t.Errorf("expected no check without a budget, got %v", err)
+	}
+	if err := checkBudgetPricing(budgetConfig{DailyUSD: 5}, chain); err == nil {
+		t.Error("expected an unpriced fallback to be rejected with a budget")
+	}
+	if err := parseLLMPrices("local:llama3.1=0/0", chain); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBudgetPricing(budgetConfig{MonthlyUSD: 50}, chain); err != nil {
+		t.Errorf("expected a priced chain to be accepted, got %v", err)
+	}
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"log/slog"
-	"os"
+	"hn30/backend/logging"
 	"sync"
 	"time"
 )
@@ -56,7 +55,7 @@ func (c *Cache) SetStoryIDs(ids []int) {
 	}
 
 	if removedCount > 0 {
-		logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+		logger := logging.L().With(
 			"event_type", "cache_operation",
 			"operation", "cleanup",
 		)
@@ -90,7 +89,7 @@ func (c *Cache) GetAll() []EnrichedStory {
 
 	// Only log if there are missing stories (cache inconsistency)
 	if len(missingIDs) > 0 {
-		logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+		logger := logging.L().With(
 			"event_type", "cache_operation",
 			"operation", "get_all",
 		)
@@ -106,6 +105,12 @@ func (c *Cache) GetAll() []EnrichedStory {
 	return stories
 }
 
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.stories)
+}
+
 func (c *Cache) SetLastUpdated(t time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -117,3 +122,59 @@ func (c *Cache) LastUpdated() time.Time {
 	defer c.mu.RUnlock()
 	return c.lastUpdated
 }
+
+// LiveCache holds stories fetched live from Hacker News for a short time,
+// so repeated requests for a story off the front page do not fetch and
+// scrape it again. It holds at most max stories.
+type LiveCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[int]liveEntry
+}
+
+type liveEntry struct {
+	story   EnrichedStory
+	expires time.Time
+}
+
+func NewLiveCache(ttl time.Duration, max int) *LiveCache {
+	return &LiveCache{
+		ttl:     ttl,
+		max:     max,
+		entries: make(map[int]liveEntry),
+	}
+}
+
+func (c *LiveCache) Get(id int) (EnrichedStory, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[id]
+	if !found || time.Now().After(e.expires) {
+		return EnrichedStory{}, false
+	}
+	return e.story, true
+}
+
+func (c *LiveCache) Set(id int, story EnrichedStory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.max {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	// Still full: make room by dropping any story, they are all cheap to
+	// fetch again.
+	for k := range c.entries {
+		if len(c.entries) < c.max {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[id] = liveEntry{story: story, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// defaultTrustedProxies is loopback only. Any other peer on a private
+// network, such as another container, could otherwise pick its own client
+// address; proxies elsewhere must be listed in TRUSTED_PROXIES.
+const defaultTrustedProxies = "127.0.0.0/8,::1/128"
+
+// trustedProxies are the networks whose forwarding headers are believed.
+// Requests from anywhere else are keyed by their socket address alone.
+var trustedProxies = mustParsePrefixes(defaultTrustedProxies)
+
+// trustedProxiesFromEnv reads TRUSTED_PROXIES, a comma-separated list of
+// CIDRs or bare IPs. "none" trusts no proxy, so forwarding headers are
+// always ignored.
+func trustedProxiesFromEnv() ([]netip.Prefix, error) {
+	v, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		return parsePrefixes(defaultTrustedProxies)
+	}
+	if strings.TrimSpace(v) == "none" {
+		return nil, nil
+	}
+	prefixes, err := parsePrefixes(v)
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	return prefixes, nil
+}
+
+// parsePrefixes parses a comma-separated list of CIDRs or bare IPs.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func mustParsePrefixes(list string) []netip.Prefix {
+	prefixes, err := parsePrefixes(list)
+	if err != nil {
+		panic(err)
+	}
+	return prefixes
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	return containsAddr(trustedProxies, addr)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that made r. Forwarding headers
+// are only consulted when the connection comes from a trusted proxy, and are
+// then read right to left: each trusted hop is skipped and the first address
+// that is not a trusted proxy is the client. Entries further left were
+// supplied by that client and could be forged.
+//
+// Forwarded (RFC 7239) is preferred over X-Forwarded-For, with X-Real-IP as
+// the last resort. The port is always stripped, so one client maps to one
+// key however many connections it opens.
+func clientIP(r *http.Request) string {
+	remote, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	chain := forwardedFor(r.Header)
+	if len(chain) == 0 {
+		chain = xForwardedFor(r.Header)
+	}
+	if len(chain) == 0 {
+		if real, ok := parseIP(r.Header.Get("X-Real-IP")); ok {
+			return real.String()
+		}
+		return remote.String()
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseIP(chain[i])
+		if !ok {
+			// A garbled or obfuscated hop; nothing to its left can be
+			// trusted, so the last hop that parsed is the best answer.
+			break
+		}
+		client = addr
+		if !isTrustedProxy(addr) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// xForwardedFor returns the X-Forwarded-For chain, joining repeated headers
+// in the order they were received.
+func xForwardedFor(h http.Header) []string {
+	var chain []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			chain = append(chain, strings.TrimSpace(hop))
+		}
+	}
+	return chain
+}
+
+// forwardedFor returns the for= parameters of the Forwarded headers.
+func forwardedFor(h http.Header) []string {
+	var chain []string
+	for _, v := range h.Values("Forwarded") {
+		for _, element := range strings.Split(v, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			// An element without for= still counts as a hop, so it stops
+			// the walk instead of letting an earlier entry through.
+			chain = append(chain, hop)
+		}
+	}
+	return chain
+}
+
+// parseIP accepts a bare IP, an IP with a port, or a bracketed IPv6 address
+// with or without a port. IPv4-mapped IPv6 addresses are unmapped.
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
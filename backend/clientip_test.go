@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	orig := trustedProxies
+	t.Cleanup(func() { trustedProxies = orig })
+	trustedProxies = mustParsePrefixes("10.0.0.0/8, 192.0.2.1")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"direct connection strips port", "198.51.100.7:5123", nil, "198.51.100.7"},
+		{"direct IPv6 strips brackets", "[2001:db8::1]:443", nil, "2001:db8::1"},
+		{"untrusted peer cannot spoof", "198.51.100.7:5123",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1"}}, "198.51.100.7"},
+		{"trusted proxy", "10.0.0.2:80",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1"}}, "203.0.113.1"},
+		{"right-most untrusted wins over forged entries", "10.0.0.2:80",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.1, 10.0.0.9"}}, "203.0.113.1"},
+		{"repeated headers form one chain", "10.0.0.2:80",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4", "203.0.113.1"}}, "203.0.113.1"},
+		{"all hops trusted", "10.0.0.2:80",
+			map[string][]string{"X-Forwarded-For": {"10.1.1.1, 192.0.2.1"}}, "10.1.1.1"},
+		{"garbled hop stops the walk", "10.0.0.2:80",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1, bogus, 10.0.0.9"}}, "10.0.0.9"},
+		{"forwarded header", "10.0.0.2:80",
+			map[string][]string{"Forwarded": {`for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https`}}, "2001:db8:cafe::17"},
+		{"forwarded preferred over x-forwarded-for", "10.0.0.2:80",
+			map[string][]string{"Forwarded": {"for=203.0.113.5"}, "X-Forwarded-For": {"203.0.113.1"}}, "203.0.113.5"},
+		{"x-real-ip fallback", "10.0.0.2:80",
+			map[string][]string{"X-Real-Ip": {"203.0.113.1"}}, "203.0.113.1"},
+		{"ipv4-mapped peer", "[::ffff:10.0.0.2]:80",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1"}}, "203.0.113.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				for _, v := range values {
+					req.Header.Add(name, v)
+				}
+			}
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	os.Unsetenv("TRUSTED_PROXIES")
+	prefixes, err := trustedProxiesFromEnv()
+	if err != nil || len(prefixes) != 2 || !prefixes[0].Contains(netip.MustParseAddr("127.0.0.1")) {
+		t.Errorf("expected only loopback by default, got %v %v", prefixes, err)
+	}
+	for _, p := range prefixes {
+		if p.Contains(netip.MustParseAddr("10.0.0.2")) {
+			t.Errorf("expected private networks not to be trusted by default, got %v", p)
+		}
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "none")
+	if prefixes, err := trustedProxiesFromEnv(); err != nil || len(prefixes) != 0 {
+		t.Errorf("expected no trusted proxies, got %v %v", prefixes, err)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,not-an-ip")
+	if _, err := trustedProxiesFromEnv(); err == nil {
+		t.Error("expected an invalid entry to be rejected")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/db"
+	"os"
+	"text/tabwriter"
+)
+
+const commandUsage = `usage: server [command]
+
+Without a command the API server is started.
+
+commands:
+  migrate status    list migrations and whether they are applied
+  migrate dry-run   print the SQL of pending migrations without applying it
+  migrate up        apply pending migrations and exit
+  backup [dir]      write a SQLite backup to dir (default $BACKUP_DIR) and
+                    prune old backups beyond $BACKUP_RETENTION
+  prune             apply the RETENTION_* data retention policy once
+`
+
+// runCommand dispatches maintenance subcommands and returns the process
+// exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "backup":
+		return runBackupCommand(args[1:])
+	case "prune":
+		return runPruneCommand()
+	case "help", "-h", "--help":
+		fmt.Print(commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], commandUsage)
+		return 2
+	}
+}
+
+func runMigrateCommand(args []string) int {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	dsn := databaseDSNFromEnv()
+
+	switch action {
+	case "status", "dry-run":
+		conn, dialect, err := db.ConnectReadOnly(dsn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "opening database: %v\n", err)
+			return 1
+		}
+		defer conn.Close()
+
+		states, err := db.MigrationStatus(conn, dialect)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reading migration status: %v\n", err)
+			return 1
+		}
+
+		if action == "status" {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+			for _, s := range states {
+				appliedAt := "pending"
+				if s.Applied {
+					appliedAt = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+			}
+			tw.Flush()
+			return 0
+		}
+
+		pending := 0
+		for _, s := range states {
+			if s.Applied {
+				continue
+			}
+			pending++
+			fmt.Printf("-- migration %d: %s\n%s\n\n", s.Version, s.Name, s.SQL)
+		}
+		if pending == 0 {
+			fmt.Println("-- no pending migrations")
+		}
+		return 0
+
+	case "up":
+		conn, _ := db.Connect(dsn, true)
+		conn.Close()
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q\n\n%s", action, commandUsage)
+		return 2
+	}
+}
+
+func runBackupCommand(args []string) int {
+	cfg, err := backupConfigFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) > 0 {
+		cfg.Dir = args[0]
+	}
+
+	dsn := databaseDSNFromEnv()
+	if db.DialectFor(dsn) != db.SQLite {
+		fmt.Fprintln(os.Stderr, "backup is only supported for SQLite, use pg_dump for PostgreSQL")
+		return 1
+	}
+
+	s := db.OpenStore(dsn)
+	defer s.Close()
+
+	backup, pruned, err := runBackup(context.Background(), s, cfg)
+	if backup.Path != "" {
+		fmt.Printf("wrote %s (%d bytes)\n", backup.Path, backup.SizeBytes)
+	}
+	for _, p := range pruned {
+		fmt.Printf("pruned %s\n", p)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runPruneCommand() int {
+	cfg, err := retentionConfigFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	s := db.OpenStore(databaseDSNFromEnv())
+	defer s.Close()
+
+	result, err := runRetention(context.Background(), s, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prune failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("snapshots downsampled: %d\narticle texts cleared: %d\nstories deleted: %d\n",
+		result.SnapshotsDownsampled, result.ArticleTextsCleared, result.StoriesDeleted)
+	return 0
+}
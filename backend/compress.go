@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Responses smaller than this are sent as-is; the framing overhead of the
+// encoders outweighs the savings on tiny payloads like a cached summary.
+const compressMinSize = 1024
+
+// Supported encodings in order of server preference, used to break ties
+// between encodings the client accepts with the same q-value.
+var supportedEncodings = []string{"zstd", "br", "gzip"}
+
+// Only text-like payloads are worth compressing. Feed types are listed so
+// RSS/Atom/JSON Feed endpoints get compressed without further wiring.
+var compressibleTypes = map[string]bool{
+	"application/json":      true,
+	"application/feed+json": true,
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/xml":       true,
+	"text/xml":              true,
+	"text/plain":            true,
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return gz
+	}},
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}},
+	"zstd": {New: func() any {
+		enc, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+}
+
+// compressionMiddleware negotiates zstd, brotli or gzip from Accept-Encoding
+// and compresses JSON and feed responses above compressMinSize.
+//
+// Handlers that set an ETag keep working: the ETag of a compressed response
+// is suffixed with the encoding (e.g. "abc-gzip") so caches never mix up
+// representations, and the suffix is stripped from If-None-Match before the
+// handler sees it so its own comparison still matches. A 304 answering an
+// encoded ETag carries the encoded ETag again.
+func compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			statusCode:     http.StatusOK,
+		}
+
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			r = r.Clone(r.Context())
+			stripped, encoded := stripETagEncoding(inm, encoding)
+			r.Header.Set("If-None-Match", stripped)
+			cw.revalidatesEncoded = encoded
+		}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks the best supported encoding for an Accept-Encoding
+// header, or "" if the response should be sent uncompressed.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supportedEncodings {
+		q, ok := qualities[enc]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// stripETagEncoding removes the "-<encoding>" suffix this middleware adds to
+// ETags from every entity tag in an If-None-Match header, and reports
+// whether any tag had it.
+func stripETagEncoding(header, encoding string) (string, bool) {
+	suffix := "-" + encoding + `"`
+	stripped := false
+	tags := strings.Split(header, ",")
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if strings.HasSuffix(tag, suffix) {
+			tag = strings.TrimSuffix(tag, suffix) + `"`
+			stripped = true
+		}
+		tags[i] = tag
+	}
+	return strings.Join(tags, ", "), stripped
+}
+
+// compressResponseWriter buffers the start of a response until it knows
+// whether the body is large enough and of the right type to compress, then
+// either streams it through a pooled encoder or passes it through untouched.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	statusCode  int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         encoder
+
+	// revalidatesEncoded is set when If-None-Match named the compressed
+	// representation, so a 304 must carry its ETag.
+	revalidatesEncoded bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	// Informational responses such as 103 Early Hints are forwarded as they
+	// come; the final status is still to follow.
+	if code >= 100 && code < http.StatusOK && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.statusCode = code
+
+	// Bodiless responses go out immediately.
+	if code == http.StatusSwitchingProtocols || code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decided = true
+		if code == http.StatusNotModified && cw.revalidatesEncoded {
+			cw.encodeETag()
+		}
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// encodeETag suffixes the ETag with the encoding, marking it as the ETag of
+// the compressed representation.
+func (cw *compressResponseWriter) encodeETag() {
+	h := cw.Header()
+	if etag := h.Get("ETag"); strings.HasSuffix(etag, `"`) {
+		h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+cw.encoding+`"`)
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < compressMinSize {
+			return len(b), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide settles on compressed or identity encoding based on what has been
+// buffered so far, sends the headers and flushes the buffer.
+func (cw *compressResponseWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if cw.shouldCompress() {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		cw.encodeETag()
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressResponseWriter) shouldCompress() bool {
+	h := cw.Header()
+	if len(cw.buf) < compressMinSize || h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return compressibleTypes[mediaType]
+}
+
+// Flush forces a decision with whatever has been buffered so streaming
+// handlers are not held back by the size threshold.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the response, sending any buffered body and returning the
+// encoder to its pool.
+func (cw *compressResponseWriter) Close() error {
+	if !cw.wroteHeader {
+		// The handler wrote nothing at all; let net/http send its default.
+		return nil
+	}
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+	return err
+}
+
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
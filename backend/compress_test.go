@@ -0,0 +1,157 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"zstd;q=0, gzip", "gzip"},
+		{"*", "zstd"},
+		{"*;q=0, gzip", "gzip"},
+		{"identity", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	body := `{"stories":"` + strings.Repeat("hacker news ", 200) + `"}`
+
+	handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/top", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected gzip Content-Encoding, got %q", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("expected Vary: Accept-Encoding, got %q", got)
+	}
+	if got := rec.Header().Get("ETag"); got != `"v1-gzip"` {
+		t.Errorf("expected encoded ETag, got %q", got)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("expected a gzip body, got %v", err)
+	}
+	decoded, _ := io.ReadAll(gz)
+	if string(decoded) != body {
+		t.Errorf("decoded body does not match original")
+	}
+
+	// A revalidation with the encoded ETag must reach the handler as the
+	// plain ETag so it can answer 304.
+	req = httptest.NewRequest("GET", "/api/top", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", `"v1-gzip"`)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for matching encoded ETag, got %d", rec.Code)
+	}
+	// The 304 validates the same representation as the 200 it answers.
+	if got := rec.Header().Get("ETag"); got != `"v1-gzip"` {
+		t.Errorf("expected the encoded ETag on the 304, got %q", got)
+	}
+
+	// A client holding the identity representation gets its own ETag back.
+	req = httptest.NewRequest("GET", "/api/top", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", `"v1"`)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != `"v1"` {
+		t.Errorf("expected 304 with the plain ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestCompressionMiddlewareSkipsSmallResponses(t *testing.T) {
+	handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"summary":"short"}`)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/summarize?id=1", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br, zstd")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("expected no Content-Encoding below threshold, got %q", got)
+	}
+	if rec.Body.String() != `{"summary":"short"}` {
+		t.Errorf("unexpected body %q", rec.Body.String())
+	}
+}
+
+func TestCompressionMiddlewareForwardsInformational(t *testing.T) {
+	body := strings.Repeat(`{"id":1,"title":"Early hints"},`, 100)
+	srv := httptest.NewServer(compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, body)
+	})))
+	defer srv.Close()
+
+	var informational []int
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	})
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if len(informational) != 1 || informational[0] != http.StatusEarlyHints {
+		t.Errorf("expected a 103 before the response, got %v", informational)
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("expected the final status 201, got %d", res.StatusCode)
+	}
+	if got := res.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("expected the final response to be compressed, got %q", got)
+	}
+}
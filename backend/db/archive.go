@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"hn30/backend/logging"
+	"hn30/backend/types"
+	"time"
+)
+
+// ArchiveEntry is one story's presence in the top list on a given UTC day.
+type ArchiveEntry struct {
+	StoredStory
+	Day         string
+	PeakPoints  int
+	BestRank    int
+	FirstSeenAt int64
+	LastSeenAt  int64
+	Appearances int
+}
+
+// RecordSnapshot stores the rank, score and comment count a story had in the
+// top list at the time of a refresh. One row per story per refresh.
+func (st *SQLStore) RecordSnapshot(ctx context.Context, s types.Story, rank int, takenAt time.Time) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "record_snapshot",
+		"story_id", s.ID,
+	)
+	start := time.Now()
+
+	_, err := st.exec(ctx, `
+		INSERT INTO story_snapshots (
+			hn_id, taken_at, rank, score, descendants
+		) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hn_id, taken_at) DO UPDATE SET
+			rank = excluded.rank,
+			score = excluded.score,
+			descendants = excluded.descendants
+		`,
+		s.ID, takenAt.Unix(), rank, s.Score, s.Descendants,
+	)
+
+	if err != nil {
+		logger.Error("snapshot insert failed",
+			"event", "snapshot_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+
+	logger.Debug("snapshot recorded",
+		"event", "snapshot_recorded",
+		"rank", rank,
+		"score", s.Score,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return nil
+}
+
+// Archive returns every story that appeared in the top list between from and
+// to (both UTC days, inclusive), one entry per story per day, ordered by day
+// and then by the peak points the story reached on that day.
+func (st *SQLStore) Archive(ctx context.Context, from, to time.Time) ([]ArchiveEntry, error) {
+	start := time.Now()
+	rangeStart := from.UTC().Truncate(24 * time.Hour)
+	rangeEnd := to.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "archive",
+		"from", rangeStart.Format(time.DateOnly),
+		"to", to.UTC().Format(time.DateOnly),
+	)
+
+	rows, err := st.query(ctx, `
+		SELECT
+			`+st.dialect.utcDay("sn.taken_at")+` AS day,
+			s.hn_id, s.title, COALESCE(s.url, ''), s.created_at,
+			COALESCE(m.by, ''), COALESCE(m.og_image, ''), COALESCE(m.og_description, ''),
+			COALESCE(m.word_count, 0), COALESCE(m.reading_time_minutes, 0),
+			COALESCE(m.language, ''),
+			MAX(sn.score) AS peak_points,
+			MIN(sn.rank) AS best_rank,
+			MAX(sn.descendants),
+			MIN(sn.taken_at), MAX(sn.taken_at),
+			COUNT(*)
+		FROM story_snapshots sn
+		JOIN stories s ON s.hn_id = sn.hn_id
+		LEFT JOIN story_metadata m ON m.hn_id = sn.hn_id
+		WHERE sn.taken_at >= ? AND sn.taken_at < ?
+		GROUP BY
+			day, sn.hn_id,
+			s.hn_id, s.title, s.url, s.created_at,
+			m."by", m.og_image, m.og_description,
+			m.word_count, m.reading_time_minutes, m.language
+		ORDER BY day ASC, peak_points DESC, best_rank ASC
+	`, rangeStart.Unix(), rangeEnd.Unix())
+	if err != nil {
+		logger.Error("archive query failed",
+			"event", "archive_query_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]ArchiveEntry, 0)
+	for rows.Next() {
+		var e ArchiveEntry
+		if err := rows.Scan(
+			&e.Day,
+			&e.ID, &e.Title, &e.URL, &e.Time,
+			&e.By, &e.OGImage, &e.OGDescription,
+			&e.Stats.WordCount, &e.Stats.ReadingTimeMinutes,
+			&e.Stats.Language,
+			&e.PeakPoints,
+			&e.BestRank,
+			&e.Descendants,
+			&e.FirstSeenAt, &e.LastSeenAt,
+			&e.Appearances,
+		); err != nil {
+			logger.Error("archive row scan failed",
+				"event", "archive_scan_failed",
+				"error", err,
+			)
+			return nil, err
+		}
+		e.Score = e.PeakPoints
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	ids := make([]int, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	tags, err := st.tagsFor(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Tags = tags[entries[i].ID]
+	}
+
+	logger.Info("archive loaded",
+		"event", "archive_query_completed",
+		"entries", len(entries),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return entries, nil
+}
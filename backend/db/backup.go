@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hn30/backend/logging"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBackupUnsupported is returned by Backup on dialects without an online
+// backup path; PostgreSQL deployments should use pg_dump instead.
+var ErrBackupUnsupported = errors.New("db: online backup is only supported on SQLite")
+
+const (
+	backupPrefix = "hn30-"
+	backupSuffix = ".db"
+	// backupTimeFormat names backups down to the nanosecond, so an
+	// on-demand backup never lands on the name of a scheduled one taken in
+	// the same second. backupParseFormat reads those names as well as the
+	// whole-second names of older backups.
+	backupTimeFormat  = "20060102T150405.000000000Z"
+	backupParseFormat = "20060102T150405Z"
+)
+
+// BackupFile is a snapshot written by Backup.
+type BackupFile struct {
+	Path      string
+	SizeBytes int64
+	CreatedAt time.Time
+}
+
+// Backup writes a consistent copy of the live SQLite database into dir using
+// VACUUM INTO, which is safe while the database is in use. The file is
+// written under a temporary name and renamed once complete, so a crash never
+// leaves a truncated backup that looks valid.
+func (st *SQLStore) Backup(ctx context.Context, dir string) (BackupFile, error) {
+	if st.dialect != SQLite {
+		return BackupFile{}, ErrBackupUnsupported
+	}
+
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "backup",
+		"backup_dir", dir,
+	)
+	start := time.Now()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return BackupFile{}, err
+	}
+
+	createdAt := time.Now().UTC()
+	path := filepath.Join(dir, backupPrefix+createdAt.Format(backupTimeFormat)+backupSuffix)
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+
+	logger.Info("backup started",
+		"event", "backup_started",
+		"backup_path", path,
+	)
+
+	if _, err := st.exec(ctx, `VACUUM INTO ?`, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		logger.Error("backup failed",
+			"event", "backup_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return BackupFile{}, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return BackupFile{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	logger.Info("backup completed",
+		"event", "backup_completed",
+		"backup_path", path,
+		"size_bytes", info.Size(),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return BackupFile{Path: path, SizeBytes: info.Size(), CreatedAt: createdAt}, nil
+}
+
+// ListBackups returns the backups in dir, newest first.
+func ListBackups(dir string) ([]BackupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]BackupFile, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		createdAt, err := time.Parse(backupParseFormat, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupFile{
+			Path:      filepath.Join(dir, name),
+			SizeBytes: info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// PruneBackups deletes all but the newest keep backups in dir and returns
+// the removed paths.
+func PruneBackups(dir string, keep int) ([]string, error) {
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0)
+	for i, b := range backups {
+		if i < keep {
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b.Path)
+	}
+	return removed, nil
+}
+
+// RestoreSQLite replaces the database at dbPath with the backup at
+// backupPath. It must run before the database is opened. The backup is
+// integrity-checked first, and the database it replaces is kept next to it
+// with a .pre-restore suffix, along with its WAL files so no committed
+// transaction is lost.
+func RestoreSQLite(backupPath, dbPath string) error {
+	logger := logging.L().With(
+		"event_type", "database_operation",
+		"operation", "restore",
+		"backup_path", backupPath,
+		"db_path", dbPath,
+	)
+	start := time.Now()
+
+	if err := checkSQLiteFile(backupPath); err != nil {
+		logger.Error("backup integrity check failed",
+			"event", "restore_failed",
+			"error", err,
+		)
+		return fmt.Errorf("backup %s failed integrity check: %w", backupPath, err)
+	}
+
+	tmpPath := dbPath + ".restore.tmp"
+	if err := copyFile(backupPath, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		preRestore := dbPath + ".pre-restore-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(dbPath, preRestore); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		// Transactions that were not checkpointed yet live only in the
+		// WAL, which SQLite finds by the database's name.
+		for _, suffix := range []string{"-wal", "-shm"} {
+			err := os.Rename(dbPath+suffix, preRestore+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				os.Remove(tmpPath)
+				return err
+			}
+		}
+		logger.Info("previous database kept",
+			"event", "restore_previous_kept",
+			"kept_path", preRestore,
+		)
+	}
+
+	// WAL files left without a database must not be replayed on top of
+	// the restored one.
+	os.Remove(dbPath + "-wal")
+	os.Remove(dbPath + "-shm")
+
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return err
+	}
+
+	logger.Info("database restored",
+		"event", "restore_completed",
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return nil
+}
+
+func checkSQLiteFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow(`PRAGMA quick_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return errors.New(result)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"hn30/backend/types"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "hn30.db")
+	backupDir := filepath.Join(dir, "backups")
+
+	store := OpenStore(dbPath)
+	story := types.Story{ID: 1, Title: "Backed up", Time: time.Now().Unix()}
+	if err := store.UpsertStory(ctx, story); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+
+	backup, err := store.Backup(ctx, backupDir)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if backup.SizeBytes == 0 {
+		t.Fatalf("expected a non-empty backup, got %+v", backup)
+	}
+
+	// Written after the backup, so a restore must drop it.
+	if err := store.UpsertStory(ctx, types.Story{ID: 2, Title: "Too late", Time: time.Now().Unix()}); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+	store.Close()
+
+	if err := RestoreSQLite(backup.Path, dbPath); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	restored := OpenStore(dbPath)
+	defer restored.Close()
+	if _, err := restored.GetStory(ctx, 1); err != nil {
+		t.Errorf("expected backed up story after restore, got %v", err)
+	}
+	if _, err := restored.GetStory(ctx, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected story written after the backup to be gone, got %v", err)
+	}
+}
+
+func TestRestoreRejectsCorruptBackup(t *testing.T) {
+	dir := t.TempDir()
+	bogus := filepath.Join(dir, "hn30-20250101T000000Z.db")
+	if err := os.WriteFile(bogus, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "hn30.db")
+	if err := RestoreSQLite(bogus, dbPath); err == nil {
+		t.Fatal("expected restoring a corrupt backup to fail")
+	}
+	if _, err := os.Stat(dbPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no database to be written, got %v", err)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"hn30-20250101T000000Z.db",
+		"hn30-20250103T000000Z.db",
+		"hn30-20250102T000000Z.db",
+		"hn30-20250104T000000Z.db.tmp", // in-flight, never pruned
+		"notes.txt",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := PruneBackups(dir, 2)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != "hn30-20250101T000000Z.db" {
+		t.Errorf("expected only the oldest backup to be pruned, got %v", removed)
+	}
+
+	backups, _ := ListBackups(dir)
+	if len(backups) != 2 || filepath.Base(backups[0].Path) != "hn30-20250103T000000Z.db" {
+		t.Errorf("expected the two newest backups newest first, got %+v", backups)
+	}
+}
+
+func TestBackupNamesDoNotCollide(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := OpenStore(filepath.Join(dir, "hn30.db"))
+	defer store.Close()
+
+	backupDir := filepath.Join(dir, "backups")
+	first, err := store.Backup(ctx, backupDir)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	second, err := store.Backup(ctx, backupDir)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if first.Path == second.Path {
+		t.Fatalf("expected two backups, both are %s", first.Path)
+	}
+	backups, err := ListBackups(backupDir)
+	if err != nil || len(backups) != 2 || backups[0].Path != second.Path {
+		t.Errorf("expected both backups newest first, got %+v, %v", backups, err)
+	}
+}
+
+func TestRestoreKeepsPreviousWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "hn30.db")
+
+	store := OpenStore(dbPath)
+	backup, err := store.Backup(ctx, filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	store.Close()
+	// Stands in for transactions not yet checkpointed into the database.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.WriteFile(dbPath+suffix, []byte("pending"+suffix), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RestoreSQLite(backup.Path, dbPath); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	kept, err := filepath.Glob(dbPath + ".pre-restore-*[0-9]Z")
+	if err != nil || len(kept) != 1 {
+		t.Fatalf("expected the previous database to be kept, got %v, %v", kept, err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if b, err := os.ReadFile(kept[0] + suffix); err != nil || string(b) != "pending"+suffix {
+			t.Errorf("expected %s to move with the previous database, got %q, %v", suffix, b, err)
+		}
+		if _, err := os.Stat(dbPath + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no %s next to the restored database, got %v", suffix, err)
+		}
+	}
+}
@@ -1,18 +1,63 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"hn30/backend/logging"
 	"hn30/backend/types"
 	"log"
-	"log/slog"
 	"os"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
+// Connect opens the database selected by dsn (see DialectFor), optionally
+// applying pending migrations, and exits the process on failure.
+func Connect(dsn string, applyMigrations bool) (*sql.DB, Dialect) {
+	if DialectFor(dsn) == Postgres {
+		return openPostgres(dsn, applyMigrations), Postgres
+	}
+	return open(dsn, applyMigrations), SQLite
+}
+
+// ConnectReadOnly opens the database selected by dsn only to inspect it.
+// Nothing is migrated or written, and a SQLite file that does not exist is
+// an error instead of being created.
+func ConnectReadOnly(dsn string) (*sql.DB, Dialect, error) {
+	if DialectFor(dsn) == Postgres {
+		conn, err := openPostgresReadOnly(dsn)
+		return conn, Postgres, err
+	}
+
+	if _, err := os.Stat(dsn); err != nil {
+		return nil, SQLite, err
+	}
+	conn, err := sql.Open("sqlite", "file:"+dsn+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return nil, SQLite, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, SQLite, err
+	}
+	return conn, SQLite, nil
+}
+
+// Open connects to the SQLite database at path and applies any pending
+// schema migrations, exiting the process on failure.
 func Open(path string) *sql.DB {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+	return open(path, true)
+}
+
+// OpenWithoutMigrations connects like Open but leaves the schema untouched,
+// for inspecting migration status before anything is applied.
+func OpenWithoutMigrations(path string) *sql.DB {
+	return open(path, false)
+}
+
+func open(path string, applyMigrations bool) *sql.DB {
+	logger := logging.L().With(
 		"event_type", "database_operation",
 		"operation", "open",
 		"db_path", path,
@@ -68,25 +113,27 @@ func Open(path string) *sql.DB {
 		"pragma_count", len(pragmas),
 	)
 
-	migrateStart := time.Now()
-	logger.Info("running database migrations",
-		"event", "migration_started",
-	)
+	if applyMigrations {
+		migrateStart := time.Now()
+		logger.Info("running database migrations",
+			"event", "migration_started",
+		)
 
-	if err := migrate(db); err != nil {
-		logger.Error("migration failed",
-			"event", "migration_failed",
-			"error", err,
+		if err := Migrate(db, SQLite); err != nil {
+			logger.Error("migration failed",
+				"event", "migration_failed",
+				"error", err,
+				"duration_ms", time.Since(migrateStart).Milliseconds(),
+			)
+			log.Fatal(err)
+		}
+
+		logger.Info("migrations completed",
+			"event", "migration_completed",
 			"duration_ms", time.Since(migrateStart).Milliseconds(),
 		)
-		log.Fatal(err)
 	}
 
-	logger.Info("migrations completed",
-		"event", "migration_completed",
-		"duration_ms", time.Since(migrateStart).Milliseconds(),
-	)
-
 	db.SetMaxOpenConns(1)
 	db.SetConnMaxLifetime(time.Hour)
 
@@ -100,52 +147,8 @@ func Open(path string) *sql.DB {
 	return db
 }
 
-func migrate(db *sql.DB) error {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
-		"event_type", "database_migration",
-	)
-	start := time.Now()
-
-	logger.Info("executing migration schema",
-		"event", "schema_execution_started",
-	)
-
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS stories (
-			hn_id INTEGER PRIMARY KEY,
-			title TEXT NOT NULL,
-			url TEXT,
-			created_at INTEGER NOT NULL,
-			last_seen_at INTEGER NOT NULL,
-			max_points INTEGER NOT NULL,
-			notified_at INTEGER
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_notified
-		ON stories (notified_at);
-	`)
-
-	if err != nil {
-		logger.Error("schema execution failed",
-			"event", "schema_execution_failed",
-			"error", err,
-			"duration_ms", time.Since(start).Milliseconds(),
-		)
-		return err
-	}
-
-	logger.Info("migration schema applied",
-		"event", "schema_execution_completed",
-		"tables", []string{"stories"},
-		"indexes", []string{"idx_notified"},
-		"duration_ms", time.Since(start).Milliseconds(),
-	)
-
-	return nil
-}
-
-func UpsertStory(db *sql.DB, s types.Story) error {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+func (st *SQLStore) UpsertStory(ctx context.Context, s types.Story) error {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "database_operation",
 		"operation", "upsert_story",
 		"story_id", s.ID,
@@ -154,14 +157,14 @@ func UpsertStory(db *sql.DB, s types.Story) error {
 	start := time.Now()
 	now := time.Now().Unix()
 
-	logger.Info("upserting story",
+	logger.Debug("upserting story",
 		"event", "upsert_started",
 		"story_url", s.URL,
 		"story_score", s.Score,
 		"story_time", s.Time,
 	)
 
-	result, err := db.Exec(`
+	result, err := st.exec(ctx, `
 		INSERT INTO stories (
 			hn_id, title, url,
 			created_at, last_seen_at,
@@ -171,7 +174,7 @@ func UpsertStory(db *sql.DB, s types.Story) error {
 			title = excluded.title,
 			url = excluded.url,
 			last_seen_at = ?,
-			max_points = MAX(max_points, excluded.max_points)
+			max_points = `+st.dialect.greatest()+`(stories.max_points, excluded.max_points)
 		`,
 		s.ID, s.Title, s.URL,
 		s.Time, now,
@@ -191,7 +194,7 @@ func UpsertStory(db *sql.DB, s types.Story) error {
 	rowsAffected, _ := result.RowsAffected()
 	lastInsertId, _ := result.LastInsertId()
 
-	logger.Info("story upserted successfully",
+	logger.Debug("story upserted successfully",
 		"event", "upsert_completed",
 		"rows_affected", rowsAffected,
 		"last_insert_id", lastInsertId,
@@ -201,101 +204,139 @@ func UpsertStory(db *sql.DB, s types.Story) error {
 	return nil
 }
 
-func ShouldNotify(db *sql.DB, s types.Story) bool {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
-		"event_type", "notification_check",
+func (st *SQLStore) UpsertStoryMetadata(ctx context.Context, s types.Story, ogImage, ogDescription string) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "upsert_story_metadata",
 		"story_id", s.ID,
-		"story_title", s.Title,
-		"story_score", s.Score,
 	)
 	start := time.Now()
 
-	var notifiedAt sql.NullInt64
-	var createdTime int64
-	var maxPoints int
-
-	logger.Info("checking notification eligibility",
-		"event", "notification_check_started",
-	)
-
-	err := db.QueryRow(`
-		SELECT notified_at, created_at, max_points
-		FROM stories
-		WHERE hn_id = ?
-	`, s.ID).Scan(&notifiedAt, &createdTime, &maxPoints)
+	err := st.WithTx(ctx, func(txStore Store) error {
+		tx := txStore.(*SQLStore)
+		_, err := tx.exec(ctx, `
+			INSERT INTO story_metadata (
+				hn_id, "by", score, descendants,
+				og_image, og_description, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(hn_id) DO UPDATE SET
+				"by" = excluded."by",
+				score = excluded.score,
+				descendants = excluded.descendants,
+				og_image = excluded.og_image,
+				og_description = excluded.og_description,
+				updated_at = excluded.updated_at
+			`,
+			s.ID, s.By, s.Score, s.Descendants,
+			ogImage, ogDescription, time.Now().Unix(),
+		)
+		if err != nil {
+			return err
+		}
+		return tx.reindexStory(ctx, s.ID)
+	})
 
 	if err != nil {
-		logger.Warn("notification check query failed",
-			"event", "query_failed",
+		logger.Error("metadata upsert failed",
+			"event", "upsert_failed",
 			"error", err,
-			"eligible", false,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return false
+		return err
 	}
 
-	now := time.Now().Unix()
-	age := now - createdTime
-
-	logger.Info("story data retrieved",
-		"event", "data_retrieved",
-		"notified_at", notifiedAt.Int64,
-		"notified_at_valid", notifiedAt.Valid,
-		"created_at", createdTime,
-		"max_points", maxPoints,
-		"age_seconds", age,
-		"current_time", now,
+	logger.Debug("story metadata upserted successfully",
+		"event", "upsert_completed",
+		"og_image_present", ogImage != "",
+		"og_description_present", ogDescription != "",
+		"duration_ms", time.Since(start).Milliseconds(),
 	)
 
-	if notifiedAt.Valid {
-		logger.Info("notification already sent",
-			"event", "notification_check_completed",
-			"reason", "already_notified",
-			"notified_at_timestamp", notifiedAt.Int64,
-			"eligible", false,
-			"duration_ms", time.Since(start).Milliseconds(),
-		)
-		return false
-	}
+	return nil
+}
 
-	if age < 60*60 {
-		logger.Info("story too new",
-			"event", "notification_check_completed",
-			"reason", "too_new",
-			"age_seconds", age,
-			"required_age_seconds", 3600,
-			"eligible", false,
+func (st *SQLStore) GetStory(ctx context.Context, id int) (StoredStory, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "get_story",
+		"story_id", id,
+	)
+	start := time.Now()
+
+	var s StoredStory
+	err := st.queryRow(ctx, `
+		SELECT
+			s.hn_id, s.title, COALESCE(s.url, ''), s.created_at,
+			COALESCE(m.score, s.max_points), COALESCE(m.by, ''),
+			COALESCE(m.descendants, 0),
+			COALESCE(m.og_image, ''), COALESCE(m.og_description, ''),
+			COALESCE(m.word_count, 0), COALESCE(m.reading_time_minutes, 0),
+			COALESCE(m.language, '')
+		FROM stories s
+		LEFT JOIN story_metadata m ON m.hn_id = s.hn_id
+		WHERE s.hn_id = ?
+	`, id).Scan(
+		&s.ID, &s.Title, &s.URL, &s.Time,
+		&s.Score, &s.By,
+		&s.Descendants,
+		&s.OGImage, &s.OGDescription,
+		&s.Stats.WordCount, &s.Stats.ReadingTimeMinutes,
+		&s.Stats.Language,
+	)
+
+	if err == sql.ErrNoRows {
+		logger.Debug("story not found",
+			"event", "get_story_completed",
+			"found", false,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return false
+		return s, ErrNotFound
 	}
-
-	if maxPoints < 600 {
-		logger.Info("insufficient points",
-			"event", "notification_check_completed",
-			"reason", "insufficient_points",
-			"max_points", maxPoints,
-			"required_points", 600,
-			"eligible", false,
+	if err == nil {
+		s.Tags, err = st.storyTags(ctx, id)
+	}
+	if err != nil {
+		logger.Error("get story failed",
+			"event", "get_story_failed",
+			"error", err,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return false
+		return s, err
 	}
 
-	logger.Info("story eligible for notification",
-		"event", "notification_check_completed",
-		"reason", "eligible",
-		"age_seconds", age,
-		"max_points", maxPoints,
-		"eligible", true,
+	logger.Debug("story loaded",
+		"event", "get_story_completed",
+		"found", true,
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 
-	return true
+	return s, nil
+}
+
+func (st *SQLStore) ShouldNotify(ctx context.Context, s types.Story) (bool, error) {
+	var notifiedAt sql.NullInt64
+	var createdTime int64
+	var maxPoints int
+
+	err := st.queryRow(ctx, `
+		SELECT notified_at, created_at, max_points
+		FROM stories
+		WHERE hn_id = ?
+	`, s.ID).Scan(&notifiedAt, &createdTime, &maxPoints)
+
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	if err != nil {
+		logNotificationQueryFailed(s, err)
+		return false, err
+	}
+
+	return notificationEligible(s, notifiedAt.Valid, notifiedAt.Int64, createdTime, maxPoints), nil
 }
 
-func MarkNotified(db *sql.DB, storyID int) error {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+func (st *SQLStore) MarkNotified(ctx context.Context, storyID int) error {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "database_operation",
 		"operation", "mark_notified",
 		"story_id", storyID,
@@ -308,7 +349,7 @@ func MarkNotified(db *sql.DB, storyID int) error {
 		"notified_at_timestamp", notifiedAt,
 	)
 
-	result, err := db.Exec(`
+	result, err := st.exec(ctx, `
 		UPDATE stories
 		SET notified_at = ?
 		WHERE hn_id = ?
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL database behind a SQLStore.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DialectFor reports which backend a DSN selects: postgres:// and
+// postgresql:// URLs select PostgreSQL, anything else is a SQLite file path.
+func DialectFor(dsn string) Dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL. Queries in
+// this package never contain a literal question mark, so no quoting
+// awareness is needed.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// greatest is the scalar function returning the larger of its arguments.
+func (d Dialect) greatest() string {
+	if d == Postgres {
+		return "GREATEST"
+	}
+	return "MAX"
+}
+
+// utcDay formats a unix timestamp column as a YYYY-MM-DD UTC date.
+func (d Dialect) utcDay(column string) string {
+	if d == Postgres {
+		return "to_char(to_timestamp(" + column + ") AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	}
+	return "strftime('%Y-%m-%d', " + column + ", 'unixepoch')"
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hn30/backend/logging"
+	"math"
+	"slices"
+	"time"
+)
+
+// StoryEmbedding is the vector for a story's text under one embedding
+// model. Vectors from different models cannot be compared.
+type StoryEmbedding struct {
+	Model  string
+	Vector []float32
+}
+
+// similarCandidates caps how many embeddings SimilarStories compares: those
+// of the most recently seen stories. Nothing else bounds the scan, since
+// stories are kept forever unless retention is configured, and on SQLite
+// the scan holds the only connection.
+var similarCandidates = 5000
+
+// SimilarStory is a stored story and its cosine similarity to the vector it
+// was found for.
+type SimilarStory struct {
+	StoredStory
+	Similarity float64
+}
+
+// encodeVector packs v as little-endian float32s.
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+func decodeVector(b []byte) ([]float32, error) {
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("db: vector of %d bytes is not a float32 array", len(b))
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v, nil
+}
+
+// cosine is the cosine similarity of a and b, or 0 when they cannot be
+// compared.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+type scoredID struct {
+	id         int
+	similarity float64
+}
+
+// nearest keeps the limit most similar candidates with a positive
+// similarity, best first.
+func nearest(candidates []scoredID, limit int) []scoredID {
+	candidates = slices.DeleteFunc(candidates, func(c scoredID) bool { return c.similarity <= 0 })
+	slices.SortFunc(candidates, func(a, b scoredID) int {
+		if a.similarity != b.similarity {
+			if a.similarity > b.similarity {
+				return -1
+			}
+			return 1
+		}
+		return a.id - b.id
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+func (st *SQLStore) SaveEmbedding(ctx context.Context, id int, e StoryEmbedding) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "save_embedding",
+		"story_id", id,
+	)
+	start := time.Now()
+
+	_, err := st.exec(ctx, `
+		INSERT INTO story_embeddings (hn_id, model, vector, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(hn_id) DO UPDATE SET
+			model = excluded.model,
+			vector = excluded.vector,
+			updated_at = excluded.updated_at
+		`,
+		id, e.Model, encodeVector(e.Vector), time.Now().Unix(),
+	)
+	if err != nil {
+		logger.Error("embedding save failed",
+			"event", "embedding_save_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+
+	logger.Debug("embedding saved",
+		"event", "embedding_saved",
+		"model", e.Model,
+		"dimensions", len(e.Vector),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return nil
+}
+
+func (st *SQLStore) GetEmbedding(ctx context.Context, id int) (StoryEmbedding, error) {
+	var e StoryEmbedding
+	var raw []byte
+	err := st.queryRow(ctx, `
+		SELECT model, vector FROM story_embeddings WHERE hn_id = ?
+	`, id).Scan(&e.Model, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return e, ErrNotFound
+	}
+	if err != nil {
+		return e, err
+	}
+	e.Vector, err = decodeVector(raw)
+	return e, err
+}
+
+// SimilarStories returns up to limit stories whose embedding under the same
+// model is closest to e, leaving out excludeID. Only the similarCandidates
+// most recently seen stories are compared.
+func (st *SQLStore) SimilarStories(ctx context.Context, e StoryEmbedding, excludeID, limit int) ([]SimilarStory, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "similar_stories",
+		"story_id", excludeID,
+		"model", e.Model,
+	)
+	start := time.Now()
+
+	rows, err := st.query(ctx, `
+		SELECT e.hn_id, e.vector
+		FROM story_embeddings e
+		JOIN stories s ON s.hn_id = e.hn_id
+		WHERE e.model = ? AND e.hn_id <> ?
+		ORDER BY s.last_seen_at DESC, s.hn_id DESC
+		LIMIT ?
+	`, e.Model, excludeID, similarCandidates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []scoredID
+	for rows.Next() {
+		var id int
+		var raw []byte
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		v, err := decodeVector(raw)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, scoredID{id, cosine(e.Vector, v)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	compared := len(candidates)
+	similar := make([]SimilarStory, 0, limit)
+	for _, c := range nearest(candidates, limit) {
+		s, err := st.GetStory(ctx, c.id)
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, SimilarStory{StoredStory: s, Similarity: c.similarity})
+	}
+
+	logger.Debug("similar stories found",
+		"event", "similar_stories_completed",
+		"compared", compared,
+		"found", len(similar),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return similar, nil
+}
+
+func (m *MemoryStore) SaveEmbedding(ctx context.Context, id int, e StoryEmbedding) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.embeddings[id] = StoryEmbedding{Model: e.Model, Vector: slices.Clone(e.Vector)}
+	return nil
+}
+
+func (m *MemoryStore) GetEmbedding(ctx context.Context, id int) (StoryEmbedding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.state.embeddings[id]
+	if !ok {
+		return StoryEmbedding{}, ErrNotFound
+	}
+	return StoryEmbedding{Model: e.Model, Vector: slices.Clone(e.Vector)}, nil
+}
+
+func (m *MemoryStore) SimilarStories(ctx context.Context, e StoryEmbedding, excludeID, limit int) ([]SimilarStory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for id, other := range m.state.embeddings {
+		if id == excludeID || other.Model != e.Model {
+			continue
+		}
+		if _, ok := m.state.stories[id]; !ok {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int) int {
+		if sa, sb := m.state.stories[a].lastSeenAt, m.state.stories[b].lastSeenAt; sa != sb {
+			return cmp.Compare(sb, sa)
+		}
+		return b - a
+	})
+	if len(ids) > similarCandidates {
+		ids = ids[:similarCandidates]
+	}
+
+	candidates := make([]scoredID, 0, len(ids))
+	for _, id := range ids {
+		candidates = append(candidates, scoredID{id, cosine(e.Vector, m.state.embeddings[id].Vector)})
+	}
+
+	similar := make([]SimilarStory, 0, limit)
+	for _, c := range nearest(candidates, limit) {
+		s, err := m.storedStory(c.id)
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, SimilarStory{StoredStory: s, Similarity: c.similarity})
+	}
+	return similar, nil
+}
@@ -0,0 +1,367 @@
+package db
+
+import (
+	"context"
+	"hn30/backend/types"
+	"html"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept entirely in memory, for tests of code that
+// needs persistence without a database file. It follows the same rules as
+// SQLStore but only approximates full-text search with substring matching.
+type MemoryStore struct {
+	mu    *sync.Mutex
+	txMu  *sync.Mutex
+	state *memoryState
+	inTx  bool
+}
+
+type memoryStory struct {
+	story      types.Story
+	lastSeenAt int64
+	maxPoints  int
+	notified   bool
+	notifiedAt int64
+}
+
+type memoryMetadata struct {
+	by            string
+	score         int
+	descendants   int
+	ogImage       string
+	ogDescription string
+	stats         ArticleStats
+}
+
+type memorySnapshot struct {
+	id          int
+	takenAt     int64
+	rank        int
+	score       int
+	descendants int
+}
+
+type memoryState struct {
+	stories    map[int]memoryStory
+	metadata   map[int]memoryMetadata
+	snapshots  map[[2]int64]memorySnapshot
+	summaries  map[int]StoredSummary
+	tags       map[int][]string
+	embeddings map[int]StoryEmbedding
+	usage      []UsageRecord
+}
+
+func (s *memoryState) clone() *memoryState {
+	return &memoryState{
+		stories:    maps.Clone(s.stories),
+		metadata:   maps.Clone(s.metadata),
+		snapshots:  maps.Clone(s.snapshots),
+		summaries:  maps.Clone(s.summaries),
+		tags:       maps.Clone(s.tags),
+		embeddings: maps.Clone(s.embeddings),
+		usage:      slices.Clone(s.usage),
+	}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu:   &sync.Mutex{},
+		txMu: &sync.Mutex{},
+		state: &memoryState{
+			stories:    make(map[int]memoryStory),
+			metadata:   make(map[int]memoryMetadata),
+			snapshots:  make(map[[2]int64]memorySnapshot),
+			summaries:  make(map[int]StoredSummary),
+			tags:       make(map[int][]string),
+			embeddings: make(map[int]StoryEmbedding),
+		},
+	}
+}
+
+// WithTx serializes transactions and restores the previous state if fn
+// fails. Writes made outside a transaction while one is running are not
+// isolated from it.
+func (m *MemoryStore) WithTx(ctx context.Context, fn func(Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.Lock()
+	backup := m.state.clone()
+	m.mu.Unlock()
+
+	if err := fn(&MemoryStore{mu: m.mu, txMu: m.txMu, state: m.state, inTx: true}); err != nil {
+		m.mu.Lock()
+		*m.state = *backup
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) UpsertStory(ctx context.Context, s types.Story) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, found := m.state.stories[s.ID]
+	if !found {
+		existing = memoryStory{maxPoints: s.Score}
+		existing.story.Time = s.Time
+	}
+	existing.story.ID = s.ID
+	existing.story.Title = s.Title
+	existing.story.URL = s.URL
+	existing.lastSeenAt = time.Now().Unix()
+	existing.maxPoints = max(existing.maxPoints, s.Score)
+
+	m.state.stories[s.ID] = existing
+	return nil
+}
+
+func (m *MemoryStore) UpsertStoryMetadata(ctx context.Context, s types.Story, ogImage, ogDescription string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Article stats are saved separately and survive metadata updates.
+	meta := m.state.metadata[s.ID]
+	meta.by = s.By
+	meta.score = s.Score
+	meta.descendants = s.Descendants
+	meta.ogImage = ogImage
+	meta.ogDescription = ogDescription
+	m.state.metadata[s.ID] = meta
+	return nil
+}
+
+func (m *MemoryStore) GetStory(ctx context.Context, id int) (StoredStory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.storedStory(id)
+}
+
+// storedStory mirrors the stories/story_metadata join. Callers hold mu.
+func (m *MemoryStore) storedStory(id int) (StoredStory, error) {
+	stored, found := m.state.stories[id]
+	if !found {
+		return StoredStory{}, ErrNotFound
+	}
+
+	s := StoredStory{Story: stored.story}
+	s.Score = stored.maxPoints
+	if meta, ok := m.state.metadata[id]; ok {
+		s.By = meta.by
+		s.Score = meta.score
+		s.Descendants = meta.descendants
+		s.OGImage = meta.ogImage
+		s.OGDescription = meta.ogDescription
+		s.Stats = meta.stats
+	}
+	s.Tags = slices.Clone(m.state.tags[id])
+	return s, nil
+}
+
+func (m *MemoryStore) RecordSnapshot(ctx context.Context, s types.Story, rank int, takenAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.snapshots[[2]int64{int64(s.ID), takenAt.Unix()}] = memorySnapshot{
+		id:          s.ID,
+		takenAt:     takenAt.Unix(),
+		rank:        rank,
+		score:       s.Score,
+		descendants: s.Descendants,
+	}
+	return nil
+}
+
+func (m *MemoryStore) Archive(ctx context.Context, from, to time.Time) ([]ArchiveEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rangeStart := from.UTC().Truncate(24 * time.Hour).Unix()
+	rangeEnd := to.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1).Unix()
+
+	type dayKey struct {
+		day string
+		id  int
+	}
+	grouped := make(map[dayKey]*ArchiveEntry)
+
+	for _, sn := range m.state.snapshots {
+		if sn.takenAt < rangeStart || sn.takenAt >= rangeEnd {
+			continue
+		}
+		story, err := m.storedStory(sn.id)
+		if err != nil {
+			continue
+		}
+
+		key := dayKey{time.Unix(sn.takenAt, 0).UTC().Format(time.DateOnly), sn.id}
+		e, found := grouped[key]
+		if !found {
+			e = &ArchiveEntry{
+				StoredStory: story,
+				Day:         key.day,
+				BestRank:    sn.rank,
+				FirstSeenAt: sn.takenAt,
+				LastSeenAt:  sn.takenAt,
+			}
+			e.Descendants = 0
+			grouped[key] = e
+		}
+		e.PeakPoints = max(e.PeakPoints, sn.score)
+		e.BestRank = min(e.BestRank, sn.rank)
+		e.Descendants = max(e.Descendants, sn.descendants)
+		e.FirstSeenAt = min(e.FirstSeenAt, sn.takenAt)
+		e.LastSeenAt = max(e.LastSeenAt, sn.takenAt)
+		e.Appearances++
+	}
+
+	entries := make([]ArchiveEntry, 0, len(grouped))
+	for _, e := range grouped {
+		e.Score = e.PeakPoints
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.PeakPoints != b.PeakPoints {
+			return a.PeakPoints > b.PeakPoints
+		}
+		return a.BestRank < b.BestRank
+	})
+
+	return entries, nil
+}
+
+func (m *MemoryStore) SaveSummary(ctx context.Context, id int, summary StoredSummary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary.CreatedAt = time.Now().Unix()
+	m.state.summaries[id] = summary
+	return nil
+}
+
+func (m *MemoryStore) GetSummary(ctx context.Context, id int) (StoredSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summary, found := m.state.summaries[id]
+	if !found {
+		return StoredSummary{}, ErrNotFound
+	}
+	return summary, nil
+}
+
+// Search matches stories containing every query word, case-insensitively,
+// ranked by how often the words occur.
+func (m *MemoryStore) Search(ctx context.Context, p SearchParams) ([]SearchResult, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := make([]string, 0)
+	for _, word := range strings.Fields(strings.ToLower(p.Query)) {
+		if word = strings.Trim(word, `"*`); word != "" {
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) == 0 {
+		return []SearchResult{}, 0, nil
+	}
+
+	matches := make([]SearchResult, 0)
+	for id := range m.state.stories {
+		story, _ := m.storedStory(id)
+		if !p.From.IsZero() && story.Time < p.From.Unix() {
+			continue
+		}
+		if !p.To.IsZero() && story.Time >= p.To.Unix() {
+			continue
+		}
+
+		summary := m.state.summaries[id]
+		text := strings.ToLower(strings.Join([]string{
+			story.Title, story.OGDescription, summary.ArticleText, summary.Summary,
+		}, " "))
+
+		hits := 0
+		for _, term := range terms {
+			n := strings.Count(text, term)
+			if n == 0 {
+				hits = 0
+				break
+			}
+			hits += n
+		}
+		if hits == 0 {
+			continue
+		}
+
+		matches = append(matches, SearchResult{
+			StoredStory: story,
+			Snippet:     html.EscapeString(story.Title),
+			Rank:        -float64(hits),
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank < matches[j].Rank
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	total := len(matches)
+	start := min(p.Offset, total)
+	end := min(start+p.Limit, total)
+	return matches[start:end], total, nil
+}
+
+func (m *MemoryStore) ShouldNotify(ctx context.Context, s types.Story) (bool, error) {
+	m.mu.Lock()
+	stored, found := m.state.stories[s.ID]
+	m.mu.Unlock()
+
+	if !found {
+		logNotificationQueryFailed(s, ErrNotFound)
+		return false, ErrNotFound
+	}
+
+	return notificationEligible(s, stored.notified, stored.notifiedAt, stored.story.Time, stored.maxPoints), nil
+}
+
+func (m *MemoryStore) MarkNotified(ctx context.Context, storyID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, found := m.state.stories[storyID]
+	if !found {
+		// Matches the SQL UPDATE, which silently affects no rows.
+		return nil
+	}
+	stored.notified = true
+	stored.notifiedAt = time.Now().Unix()
+	m.state.stories[storyID] = stored
+	return nil
+}
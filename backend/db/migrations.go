@@ -0,0 +1,466 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"hn30/backend/logging"
+	"time"
+)
+
+// migration is one step of the schema history, written once per dialect.
+type migration struct {
+	version  int
+	name     string
+	sqlite   string
+	postgres string
+}
+
+func (m migration) sql(d Dialect) string {
+	if d == Postgres {
+		return m.postgres
+	}
+	return m.sqlite
+}
+
+// migrations is the ordered schema history. Append new entries with the
+// next version number; never edit or reorder one that has shipped. Both
+// dialects must produce equivalent schemas.
+//
+// The early migrations use IF NOT EXISTS because they reproduce the schema
+// databases had before versioning was introduced, so those databases adopt
+// the history without changes.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_stories",
+		sqlite: `
+			CREATE TABLE IF NOT EXISTS stories (
+				hn_id INTEGER PRIMARY KEY,
+				title TEXT NOT NULL,
+				url TEXT,
+				created_at INTEGER NOT NULL,
+				last_seen_at INTEGER NOT NULL,
+				max_points INTEGER NOT NULL,
+				notified_at INTEGER
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_notified
+			ON stories (notified_at);
+		`,
+		postgres: `
+			CREATE TABLE IF NOT EXISTS stories (
+				hn_id BIGINT PRIMARY KEY,
+				title TEXT NOT NULL,
+				url TEXT,
+				created_at BIGINT NOT NULL,
+				last_seen_at BIGINT NOT NULL,
+				max_points INTEGER NOT NULL,
+				notified_at BIGINT
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_notified
+			ON stories (notified_at);
+		`,
+	},
+	{
+		version: 2,
+		name:    "create_story_metadata",
+		sqlite: `
+			CREATE TABLE IF NOT EXISTS story_metadata (
+				hn_id INTEGER PRIMARY KEY,
+				by TEXT,
+				score INTEGER NOT NULL DEFAULT 0,
+				descendants INTEGER NOT NULL DEFAULT 0,
+				og_image TEXT,
+				og_description TEXT,
+				updated_at INTEGER NOT NULL
+			);
+		`,
+		postgres: `
+			CREATE TABLE IF NOT EXISTS story_metadata (
+				hn_id BIGINT PRIMARY KEY,
+				"by" TEXT,
+				score INTEGER NOT NULL DEFAULT 0,
+				descendants INTEGER NOT NULL DEFAULT 0,
+				og_image TEXT,
+				og_description TEXT,
+				updated_at BIGINT NOT NULL
+			);
+		`,
+	},
+	{
+		version: 3,
+		name:    "create_story_snapshots",
+		sqlite: `
+			CREATE TABLE IF NOT EXISTS story_snapshots (
+				hn_id INTEGER NOT NULL,
+				taken_at INTEGER NOT NULL,
+				rank INTEGER NOT NULL,
+				score INTEGER NOT NULL,
+				descendants INTEGER NOT NULL,
+				PRIMARY KEY (hn_id, taken_at)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_snapshots_taken_at
+			ON story_snapshots (taken_at);
+		`,
+		postgres: `
+			CREATE TABLE IF NOT EXISTS story_snapshots (
+				hn_id BIGINT NOT NULL,
+				taken_at BIGINT NOT NULL,
+				rank INTEGER NOT NULL,
+				score INTEGER NOT NULL,
+				descendants INTEGER NOT NULL,
+				PRIMARY KEY (hn_id, taken_at)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_snapshots_taken_at
+			ON story_snapshots (taken_at);
+		`,
+	},
+	{
+		version: 4,
+		name:    "create_summaries_and_search",
+		sqlite: `
+			CREATE TABLE IF NOT EXISTS summaries (
+				hn_id INTEGER PRIMARY KEY,
+				summary TEXT NOT NULL,
+				model TEXT,
+				article_text TEXT,
+				created_at INTEGER NOT NULL
+			);
+
+			CREATE VIRTUAL TABLE IF NOT EXISTS story_search USING fts5(
+				title, description, article_text, summary,
+				tokenize = 'porter unicode61'
+			);
+
+			INSERT INTO story_search (rowid, title, description, article_text, summary)
+			SELECT
+				s.hn_id, s.title,
+				COALESCE(m.og_description, ''),
+				COALESCE(su.article_text, ''),
+				COALESCE(su.summary, '')
+			FROM stories s
+			LEFT JOIN story_metadata m ON m.hn_id = s.hn_id
+			LEFT JOIN summaries su ON su.hn_id = s.hn_id
+			WHERE s.hn_id NOT IN (SELECT rowid FROM story_search);
+		`,
+		postgres: `
+			CREATE TABLE IF NOT EXISTS summaries (
+				hn_id BIGINT PRIMARY KEY,
+				summary TEXT NOT NULL,
+				model TEXT,
+				article_text TEXT,
+				created_at BIGINT NOT NULL
+			);
+
+			-- Mirrors the SQLite FTS5 table. Article text is capped so very
+			-- long documents stay below the tsvector size limit.
+			CREATE TABLE IF NOT EXISTS story_search (
+				hn_id BIGINT PRIMARY KEY,
+				title TEXT NOT NULL DEFAULT '',
+				description TEXT NOT NULL DEFAULT '',
+				article_text TEXT NOT NULL DEFAULT '',
+				summary TEXT NOT NULL DEFAULT '',
+				document TSVECTOR GENERATED ALWAYS AS (
+					setweight(to_tsvector('english', title), 'A') ||
+					setweight(to_tsvector('english', description), 'B') ||
+					setweight(to_tsvector('english', summary), 'B') ||
+					setweight(to_tsvector('english', left(article_text, 200000)), 'C')
+				) STORED
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_story_search_document
+			ON story_search USING GIN (document);
+
+			INSERT INTO story_search (hn_id, title, description, article_text, summary)
+			SELECT
+				s.hn_id, s.title,
+				COALESCE(m.og_description, ''),
+				COALESCE(su.article_text, ''),
+				COALESCE(su.summary, '')
+			FROM stories s
+			LEFT JOIN story_metadata m ON m.hn_id = s.hn_id
+			LEFT JOIN summaries su ON su.hn_id = s.hn_id
+			ON CONFLICT (hn_id) DO NOTHING;
+		`,
+	},
+	{
+		version: 5,
+		name:    "create_llm_usage",
+		sqlite: `
+			CREATE TABLE llm_usage (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				hn_id INTEGER,
+				provider TEXT NOT NULL,
+				model TEXT NOT NULL,
+				prompt_tokens INTEGER NOT NULL,
+				completion_tokens INTEGER NOT NULL,
+				cost_usd REAL NOT NULL,
+				created_at INTEGER NOT NULL
+			);
+
+			CREATE INDEX idx_llm_usage_created_at
+			ON llm_usage (created_at);
+		`,
+		postgres: `
+			CREATE TABLE llm_usage (
+				id BIGSERIAL PRIMARY KEY,
+				hn_id BIGINT,
+				provider TEXT NOT NULL,
+				model TEXT NOT NULL,
+				prompt_tokens INTEGER NOT NULL,
+				completion_tokens INTEGER NOT NULL,
+				cost_usd DOUBLE PRECISION NOT NULL,
+				created_at BIGINT NOT NULL
+			);
+
+			CREATE INDEX idx_llm_usage_created_at
+			ON llm_usage (created_at);
+		`,
+	},
+	{
+		version:  6,
+		name:     "add_summary_prompt_version",
+		sqlite:   `ALTER TABLE summaries ADD COLUMN prompt_version TEXT;`,
+		postgres: `ALTER TABLE summaries ADD COLUMN prompt_version TEXT;`,
+	},
+	{
+		version: 7,
+		name:    "add_story_article_stats",
+		sqlite: `
+			ALTER TABLE story_metadata ADD COLUMN word_count INTEGER;
+			ALTER TABLE story_metadata ADD COLUMN reading_time_minutes INTEGER;
+			ALTER TABLE story_metadata ADD COLUMN language TEXT;
+		`,
+		postgres: `
+			ALTER TABLE story_metadata ADD COLUMN word_count INTEGER;
+			ALTER TABLE story_metadata ADD COLUMN reading_time_minutes INTEGER;
+			ALTER TABLE story_metadata ADD COLUMN language TEXT;
+		`,
+	},
+	{
+		version: 8,
+		name:    "create_story_tags",
+		sqlite: `
+			CREATE TABLE story_tags (
+				hn_id INTEGER NOT NULL,
+				tag TEXT NOT NULL,
+				PRIMARY KEY (hn_id, tag)
+			);
+
+			CREATE INDEX idx_story_tags_tag
+			ON story_tags (tag);
+		`,
+		postgres: `
+			CREATE TABLE story_tags (
+				hn_id BIGINT NOT NULL,
+				tag TEXT NOT NULL,
+				PRIMARY KEY (hn_id, tag)
+			);
+
+			CREATE INDEX idx_story_tags_tag
+			ON story_tags (tag);
+		`,
+	},
+	{
+		version: 9,
+		name:    "create_story_embeddings",
+		sqlite: `
+			CREATE TABLE story_embeddings (
+				hn_id INTEGER PRIMARY KEY,
+				model TEXT NOT NULL,
+				vector BLOB NOT NULL,
+				updated_at INTEGER NOT NULL
+			);
+
+			CREATE INDEX idx_story_embeddings_model
+			ON story_embeddings (model);
+		`,
+		postgres: `
+			CREATE TABLE story_embeddings (
+				hn_id BIGINT PRIMARY KEY,
+				model TEXT NOT NULL,
+				vector BYTEA NOT NULL,
+				updated_at BIGINT NOT NULL
+			);
+
+			CREATE INDEX idx_story_embeddings_model
+			ON story_embeddings (model);
+		`,
+	},
+	{
+		version: 10,
+		name:    "add_llm_usage_operation",
+		// Usage recorded before this was all for summaries.
+		sqlite:   `ALTER TABLE llm_usage ADD COLUMN operation TEXT NOT NULL DEFAULT 'generate_summary';`,
+		postgres: `ALTER TABLE llm_usage ADD COLUMN operation TEXT NOT NULL DEFAULT 'generate_summary';`,
+	},
+}
+
+// MigrationState describes one known migration and whether it has been
+// applied to a database.
+type MigrationState struct {
+	Version   int
+	Name      string
+	SQL       string // for the dialect the status was read from
+	Applied   bool
+	AppliedAt time.Time
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at BIGINT NOT NULL
+		);
+	`)
+	return err
+}
+
+// migrationsTableExists reports whether schema_migrations has been created.
+func migrationsTableExists(db *sql.DB, d Dialect) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	if d == Postgres {
+		query = `
+			SELECT COUNT(*) FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = 'schema_migrations'
+		`
+	}
+	var n int
+	err := db.QueryRow(query).Scan(&n)
+	return n > 0, err
+}
+
+// MigrationStatus lists every known migration in order along with when it
+// was applied. It only reads the database: without a schema_migrations
+// table, nothing has been applied.
+func MigrationStatus(db *sql.DB, d Dialect) ([]MigrationState, error) {
+	exists, err := migrationsTableExists(db, d)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]int64)
+	if exists {
+		if applied, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.version, Name: m.name, SQL: m.sql(d)}
+		if appliedAt, ok := applied[m.version]; ok {
+			state.Applied = true
+			state.AppliedAt = time.Unix(appliedAt, 0)
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// appliedMigrations maps each applied version to when it was applied.
+func appliedMigrations(db *sql.DB) (map[int]int64, error) {
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every pending migration in version order. Each migration
+// runs in its own transaction together with its schema_migrations row, so a
+// failure leaves the database at the last fully applied version.
+func Migrate(db *sql.DB, d Dialect) error {
+	logger := logging.L().With(
+		"event_type", "database_migration",
+		"dialect", d,
+	)
+	start := time.Now()
+
+	if err := ensureMigrationsTable(db); err != nil {
+		logger.Error("migrations table creation failed",
+			"event", "migration_status_failed",
+			"error", err,
+		)
+		return err
+	}
+	states, err := MigrationStatus(db, d)
+	if err != nil {
+		logger.Error("migration status failed",
+			"event", "migration_status_failed",
+			"error", err,
+		)
+		return err
+	}
+
+	appliedCount := 0
+	for i, state := range states {
+		if state.Applied {
+			continue
+		}
+
+		if err := applyMigration(db, d, migrations[i]); err != nil {
+			logger.Error("migration failed",
+				"event", "migration_apply_failed",
+				"version", state.Version,
+				"name", state.Name,
+				"error", err,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+			return fmt.Errorf("migration %d (%s): %w", state.Version, state.Name, err)
+		}
+
+		logger.Info("migration applied",
+			"event", "migration_applied",
+			"version", state.Version,
+			"name", state.Name,
+		)
+		appliedCount++
+	}
+
+	logger.Info("schema up to date",
+		"event", "schema_up_to_date",
+		"applied_count", appliedCount,
+		"schema_version", migrations[len(migrations)-1].version,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, d Dialect, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql(d)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(d.rebind(`
+		INSERT INTO schema_migrations (version, name, applied_at)
+		VALUES (?, ?, ?)
+	`), m.version, m.name, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	conn := Open(filepath.Join(t.TempDir(), "hn30.db"))
+	defer conn.Close()
+
+	states, err := MigrationStatus(conn, SQLite)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(states) != len(migrations) {
+		t.Fatalf("expected %d migrations, got %d", len(migrations), len(states))
+	}
+	for _, s := range states {
+		if !s.Applied {
+			t.Errorf("expected migration %d (%s) to be applied", s.Version, s.Name)
+		}
+	}
+
+	// Running again must be a no-op.
+	if err := Migrate(conn, SQLite); err != nil {
+		t.Fatalf("expected re-running migrations to succeed, got %v", err)
+	}
+}
+
+func TestMigrateAdoptsUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hn30.db")
+
+	// A database created before schema_migrations existed.
+	legacy := OpenWithoutMigrations(path)
+	_, err := legacy.Exec(`
+		CREATE TABLE stories (
+			hn_id INTEGER PRIMARY KEY,
+			title TEXT NOT NULL,
+			url TEXT,
+			created_at INTEGER NOT NULL,
+			last_seen_at INTEGER NOT NULL,
+			max_points INTEGER NOT NULL,
+			notified_at INTEGER
+		);
+		INSERT INTO stories (hn_id, title, url, created_at, last_seen_at, max_points)
+		VALUES (1, 'Show HN: hn30', 'https://hn30.yamanlabs.com', 1700000000, 1700000000, 700);
+	`)
+	if err != nil {
+		t.Fatalf("creating legacy schema: %v", err)
+	}
+
+	states, err := MigrationStatus(legacy, SQLite)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, s := range states {
+		if s.Applied {
+			t.Errorf("expected migration %d to be pending on a legacy database", s.Version)
+		}
+	}
+	legacy.Close()
+
+	store := NewSQLiteStore(Open(path))
+	defer store.Close()
+
+	stored, err := store.GetStory(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected legacy story to survive migration, got %v", err)
+	}
+	if stored.Title != "Show HN: hn30" || stored.Score != 700 {
+		t.Errorf("unexpected story after migration: %+v", stored)
+	}
+
+	results, total, err := store.Search(context.Background(), SearchParams{Query: "hn30", Limit: 10})
+	if err != nil {
+		t.Fatalf("expected search to work after migration, got %v", err)
+	}
+	if total != 1 || len(results) != 1 {
+		t.Errorf("expected legacy story to be backfilled into the search index, got %d results", total)
+	}
+}
+
+func TestMigrationStatusIsReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hn30.db")
+
+	if _, _, err := ConnectReadOnly(path); err == nil {
+		t.Error("expected an error for a database that does not exist")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no database file to be created, got %v", err)
+	}
+
+	OpenWithoutMigrations(path).Close()
+	conn, dialect, err := ConnectReadOnly(path)
+	if err != nil {
+		t.Fatalf("connect read-only: %v", err)
+	}
+	defer conn.Close()
+
+	states, err := MigrationStatus(conn, dialect)
+	if err != nil {
+		t.Fatalf("migration status: %v", err)
+	}
+	for _, s := range states {
+		if s.Applied {
+			t.Errorf("expected migration %d to be pending", s.Version)
+		}
+	}
+	if exists, err := migrationsTableExists(conn, dialect); err != nil || exists {
+		t.Errorf("expected schema_migrations not to be created, got %v, %v", exists, err)
+	}
+	if _, err := conn.Exec(`CREATE TABLE t (x INTEGER)`); err == nil {
+		t.Error("expected the connection to refuse writes")
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"hn30/backend/logging"
+	"log"
+	"net/url"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// openPostgresReadOnly connects with every transaction read-only, so the
+// server itself refuses writes.
+func openPostgresReadOnly(dsn string) (*sql.DB, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("default_transaction_read_only", "on")
+	u.RawQuery = q.Encode()
+
+	db, err := sql.Open("pgx", u.String())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openPostgres(dsn string, applyMigrations bool) *sql.DB {
+	// Never log the password.
+	redacted := "postgres://"
+	if u, err := url.Parse(dsn); err == nil {
+		redacted = u.Redacted()
+	}
+
+	logger := logging.L().With(
+		"event_type", "database_operation",
+		"operation", "open",
+		"dialect", "postgres",
+		"dsn", redacted,
+	)
+	start := time.Now()
+
+	logger.Info("opening database",
+		"event", "db_open_started",
+	)
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		logger.Error("database open failed",
+			"event", "db_open_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		logger.Error("database ping failed",
+			"event", "db_open_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		log.Fatal(err)
+	}
+
+	logger.Info("database connection opened",
+		"event", "db_connection_opened",
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	if applyMigrations {
+		migrateStart := time.Now()
+		logger.Info("running database migrations",
+			"event", "migration_started",
+		)
+
+		if err := Migrate(db, Postgres); err != nil {
+			logger.Error("migration failed",
+				"event", "migration_failed",
+				"error", err,
+				"duration_ms", time.Since(migrateStart).Milliseconds(),
+			)
+			log.Fatal(err)
+		}
+
+		logger.Info("migrations completed",
+			"event", "migration_completed",
+			"duration_ms", time.Since(migrateStart).Milliseconds(),
+		)
+	}
+
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(time.Hour)
+
+	logger.Info("database ready",
+		"event", "db_open_completed",
+		"max_open_conns", 10,
+		"conn_max_lifetime", "1h",
+		"total_duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return db
+}
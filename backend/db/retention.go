@@ -0,0 +1,276 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"hn30/backend/logging"
+	"time"
+)
+
+// RetentionPolicy says how long each kind of history is kept at full
+// detail. A zero duration disables that part of the policy.
+type RetentionPolicy struct {
+	// SnapshotMaxAge is how long every per-refresh snapshot is kept. Older
+	// snapshots are downsampled to one row per story per UTC day holding the
+	// day's best rank, peak score and highest comment count.
+	SnapshotMaxAge time.Duration
+
+	// ArticleTextMaxAge is how long extracted article text is kept next to
+	// a summary. The summary itself is never pruned.
+	ArticleTextMaxAge time.Duration
+
+	// StoryMaxAge removes stories, with their metadata, snapshots and
+	// summaries, that have not been in the top list for this long.
+	StoryMaxAge time.Duration
+}
+
+// PruneResult counts the rows changed by Prune.
+type PruneResult struct {
+	SnapshotsDownsampled int64 // snapshot rows merged into their day's row
+	ArticleTextsCleared  int64
+	StoriesDeleted       int64
+}
+
+// dayStart returns the start of the UTC day containing now-age, so
+// downsampling never splits a day between kept and merged rows.
+func dayStart(now time.Time, age time.Duration) int64 {
+	return now.Add(-age).UTC().Truncate(24 * time.Hour).Unix()
+}
+
+// Prune applies policy relative to now in a single transaction.
+func (st *SQLStore) Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (PruneResult, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "prune",
+	)
+	start := time.Now()
+
+	var result PruneResult
+	err := st.WithTx(ctx, func(txStore Store) error {
+		tx := txStore.(*SQLStore)
+
+		if policy.StoryMaxAge > 0 {
+			n, err := tx.deleteStaleStories(ctx, now.Add(-policy.StoryMaxAge).Unix())
+			if err != nil {
+				return err
+			}
+			result.StoriesDeleted = n
+		}
+
+		if policy.SnapshotMaxAge > 0 {
+			n, err := tx.downsampleSnapshots(ctx, dayStart(now, policy.SnapshotMaxAge))
+			if err != nil {
+				return err
+			}
+			result.SnapshotsDownsampled = n
+		}
+
+		if policy.ArticleTextMaxAge > 0 {
+			n, err := tx.clearArticleText(ctx, now.Add(-policy.ArticleTextMaxAge).Unix())
+			if err != nil {
+				return err
+			}
+			result.ArticleTextsCleared = n
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logger.Error("prune failed",
+			"event", "prune_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return PruneResult{}, err
+	}
+
+	logger.Info("prune completed",
+		"event", "prune_completed",
+		"snapshots_downsampled", result.SnapshotsDownsampled,
+		"article_texts_cleared", result.ArticleTextsCleared,
+		"stories_deleted", result.StoriesDeleted,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return result, nil
+}
+
+// downsampleSnapshots merges the snapshots taken before cutoff into the
+// first snapshot of each story's UTC day. taken_at / 86400 is the day
+// number in both dialects since taken_at is an integer Unix time.
+func (st *SQLStore) downsampleSnapshots(ctx context.Context, cutoff int64) (int64, error) {
+	const sameDay = `
+		FROM story_snapshots o
+		WHERE o.hn_id = story_snapshots.hn_id
+		AND o.taken_at / 86400 = story_snapshots.taken_at / 86400`
+
+	_, err := st.exec(ctx, `
+		UPDATE story_snapshots SET
+			rank = (SELECT MIN(o.rank) `+sameDay+`),
+			score = (SELECT MAX(o.score) `+sameDay+`),
+			descendants = (SELECT MAX(o.descendants) `+sameDay+`)
+		WHERE taken_at < ?
+		AND taken_at = (SELECT MIN(o.taken_at) `+sameDay+`)
+		AND (SELECT COUNT(*) `+sameDay+`) > 1
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := st.exec(ctx, `
+		DELETE FROM story_snapshots
+		WHERE taken_at < ?
+		AND taken_at > (SELECT MIN(o.taken_at) `+sameDay+`)
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (st *SQLStore) clearArticleText(ctx context.Context, cutoff int64) (int64, error) {
+	rows, err := st.query(ctx, `
+		SELECT hn_id FROM summaries
+		WHERE created_at < ? AND article_text IS NOT NULL AND article_text <> ''
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if _, err := st.exec(ctx, `UPDATE summaries SET article_text = '' WHERE hn_id = ?`, id); err != nil {
+			return 0, err
+		}
+		// Search falls back to the title, description and summary.
+		if err := st.reindexStory(ctx, id); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), nil
+}
+
+func (st *SQLStore) deleteStaleStories(ctx context.Context, cutoff int64) (int64, error) {
+	rows, err := st.query(ctx, `SELECT hn_id FROM stories WHERE last_seen_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	searchKey := "rowid"
+	if st.dialect == Postgres {
+		searchKey = "hn_id"
+	}
+
+	for _, id := range ids {
+		for _, stmt := range []string{
+			`DELETE FROM story_search WHERE ` + searchKey + ` = ?`,
+			`DELETE FROM summaries WHERE hn_id = ?`,
+			`DELETE FROM story_snapshots WHERE hn_id = ?`,
+			`DELETE FROM story_tags WHERE hn_id = ?`,
+			`DELETE FROM story_embeddings WHERE hn_id = ?`,
+			`DELETE FROM story_metadata WHERE hn_id = ?`,
+			`DELETE FROM stories WHERE hn_id = ?`,
+		} {
+			if _, err := st.exec(ctx, stmt, id); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int64(len(ids)), nil
+}
+
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (m *MemoryStore) Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (PruneResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result PruneResult
+
+	if policy.StoryMaxAge > 0 {
+		cutoff := now.Add(-policy.StoryMaxAge).Unix()
+		for id, s := range m.state.stories {
+			if s.lastSeenAt >= cutoff {
+				continue
+			}
+			delete(m.state.stories, id)
+			delete(m.state.metadata, id)
+			delete(m.state.summaries, id)
+			delete(m.state.tags, id)
+			delete(m.state.embeddings, id)
+			for key, sn := range m.state.snapshots {
+				if sn.id == id {
+					delete(m.state.snapshots, key)
+				}
+			}
+			result.StoriesDeleted++
+		}
+	}
+
+	if policy.SnapshotMaxAge > 0 {
+		cutoff := dayStart(now, policy.SnapshotMaxAge)
+		type dayKey struct {
+			id  int
+			day int64
+		}
+		keepers := make(map[dayKey]memorySnapshot)
+		for _, sn := range m.state.snapshots {
+			if sn.takenAt >= cutoff {
+				continue
+			}
+			key := dayKey{sn.id, sn.takenAt / 86400}
+			k, found := keepers[key]
+			if !found {
+				keepers[key] = sn
+				continue
+			}
+			result.SnapshotsDownsampled++
+			k.rank = min(k.rank, sn.rank)
+			k.score = max(k.score, sn.score)
+			k.descendants = max(k.descendants, sn.descendants)
+			k.takenAt = min(k.takenAt, sn.takenAt)
+			keepers[key] = k
+		}
+		for key, sn := range m.state.snapshots {
+			if sn.takenAt < cutoff {
+				delete(m.state.snapshots, key)
+			}
+		}
+		for _, sn := range keepers {
+			m.state.snapshots[[2]int64{int64(sn.id), sn.takenAt}] = sn
+		}
+	}
+
+	if policy.ArticleTextMaxAge > 0 {
+		cutoff := now.Add(-policy.ArticleTextMaxAge).Unix()
+		for id, s := range m.state.summaries {
+			if s.CreatedAt < cutoff && s.ArticleText != "" {
+				s.ArticleText = ""
+				m.state.summaries[id] = s
+				result.ArticleTextsCleared++
+			}
+		}
+	}
+
+	return result, nil
+}
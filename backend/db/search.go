@@ -0,0 +1,335 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"hn30/backend/logging"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Snippet markers are control characters that cannot appear in the HTML
+// escaped output, so they can be swapped for <mark> tags after escaping.
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+type StoredSummary struct {
+	Summary     string
+	Model       string
+	ArticleText string
+	// PromptVersion identifies the prompt template the summary was
+	// generated with; empty for summaries from before templates.
+	PromptVersion string
+	CreatedAt     int64
+}
+
+type SearchParams struct {
+	Query  string
+	From   time.Time // zero means unbounded
+	To     time.Time // exclusive, zero means unbounded
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	StoredStory
+	// Snippet is HTML-escaped text around the best match with matched
+	// terms wrapped in <mark> tags.
+	Snippet string
+	// Rank orders results, lower is better.
+	Rank float64
+}
+
+// reindexStory rebuilds the full-text index row of a story from the stories,
+// story_metadata and summaries tables. The index row id is the HN id.
+func (st *SQLStore) reindexStory(ctx context.Context, id int) error {
+	// FTS5 tables key rows by rowid, the PostgreSQL table has a column.
+	key := "rowid"
+	if st.dialect == Postgres {
+		key = "hn_id"
+	}
+
+	if _, err := st.exec(ctx, `DELETE FROM story_search WHERE `+key+` = ?`, id); err != nil {
+		return err
+	}
+
+	_, err := st.exec(ctx, `
+		INSERT INTO story_search (`+key+`, title, description, article_text, summary)
+		SELECT
+			s.hn_id, s.title,
+			COALESCE(m.og_description, ''),
+			COALESCE(su.article_text, ''),
+			COALESCE(su.summary, '')
+		FROM stories s
+		LEFT JOIN story_metadata m ON m.hn_id = s.hn_id
+		LEFT JOIN summaries su ON su.hn_id = s.hn_id
+		WHERE s.hn_id = ?
+	`, id)
+	return err
+}
+
+func (st *SQLStore) SaveSummary(ctx context.Context, id int, summary StoredSummary) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "save_summary",
+		"story_id", id,
+	)
+	start := time.Now()
+
+	err := st.WithTx(ctx, func(txStore Store) error {
+		tx := txStore.(*SQLStore)
+		_, err := tx.exec(ctx, `
+			INSERT INTO summaries (
+				hn_id, summary, model, article_text, prompt_version, created_at
+			) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(hn_id) DO UPDATE SET
+				summary = excluded.summary,
+				model = excluded.model,
+				article_text = excluded.article_text,
+				prompt_version = excluded.prompt_version,
+				created_at = excluded.created_at
+			`,
+			id, summary.Summary, summary.Model, summary.ArticleText, summary.PromptVersion, time.Now().Unix(),
+		)
+		if err != nil {
+			return err
+		}
+		return tx.reindexStory(ctx, id)
+	})
+
+	if err != nil {
+		logger.Error("save summary failed",
+			"event", "save_summary_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+
+	logger.Info("summary saved",
+		"event", "save_summary_completed",
+		"summary_length", len(summary.Summary),
+		"article_length", len(summary.ArticleText),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return nil
+}
+
+// GetSummary returns the stored summary of a story, or ErrNotFound if none
+// has been generated yet.
+func (st *SQLStore) GetSummary(ctx context.Context, id int) (StoredSummary, error) {
+	var s StoredSummary
+	err := st.queryRow(ctx, `
+		SELECT summary, COALESCE(model, ''), COALESCE(article_text, ''), COALESCE(prompt_version, ''), created_at
+		FROM summaries
+		WHERE hn_id = ?
+	`, id).Scan(&s.Summary, &s.Model, &s.ArticleText, &s.PromptVersion, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return s, ErrNotFound
+	}
+	return s, err
+}
+
+// Search runs a full-text query over every story seen by the refresher,
+// ranked by BM25 with title matches weighted highest. It returns one page of
+// results and the total number of matches.
+func (st *SQLStore) Search(ctx context.Context, p SearchParams) ([]SearchResult, int, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "search",
+		"query", p.Query,
+	)
+	start := time.Now()
+
+	var match, countQuery, searchQuery string
+	var snippetArgs []any
+	if st.dialect == Postgres {
+		match = tsQuery(p.Query)
+		countQuery = `
+			SELECT COUNT(*)
+			FROM story_search ss
+			JOIN stories s ON s.hn_id = ss.hn_id
+			WHERE ss.document @@ to_tsquery('english', ?)
+				AND s.created_at >= ? AND s.created_at < ?
+		`
+		searchQuery = `
+			SELECT
+				s.hn_id, s.title, COALESCE(s.url, ''), s.created_at,
+				COALESCE(m.score, s.max_points), COALESCE(m.by, ''),
+				COALESCE(m.descendants, 0),
+				COALESCE(m.og_image, ''), COALESCE(m.og_description, ''),
+				COALESCE(m.word_count, 0), COALESCE(m.reading_time_minutes, 0),
+				COALESCE(m.language, ''),
+				ts_headline('english', ss.title || ' ' || ss.description || ' ' || ss.summary, q.query, ?),
+				-ts_rank_cd(ss.document, q.query) AS rank
+			FROM story_search ss
+			CROSS JOIN (SELECT to_tsquery('english', ?) AS query) q
+			JOIN stories s ON s.hn_id = ss.hn_id
+			LEFT JOIN story_metadata m ON m.hn_id = s.hn_id
+			WHERE ss.document @@ q.query
+				AND s.created_at >= ? AND s.created_at < ?
+			ORDER BY rank, s.hn_id
+			LIMIT ? OFFSET ?
+		`
+		snippetArgs = []any{`StartSel="` + snippetOpen + `", StopSel="` + snippetClose + `", MaxWords=35, MinWords=15`}
+	} else {
+		match = ftsQuery(p.Query)
+		countQuery = `
+			SELECT COUNT(*)
+			FROM story_search
+			JOIN stories s ON s.hn_id = story_search.rowid
+			WHERE story_search MATCH ?
+				AND s.created_at >= ? AND s.created_at < ?
+		`
+		searchQuery = `
+			SELECT
+				s.hn_id, s.title, COALESCE(s.url, ''), s.created_at,
+				COALESCE(m.score, s.max_points), COALESCE(m.by, ''),
+				COALESCE(m.descendants, 0),
+				COALESCE(m.og_image, ''), COALESCE(m.og_description, ''),
+				COALESCE(m.word_count, 0), COALESCE(m.reading_time_minutes, 0),
+				COALESCE(m.language, ''),
+				snippet(story_search, -1, ?, ?, '…', 24),
+				bm25(story_search, 10.0, 4.0, 1.0, 2.0) AS rank
+			FROM story_search
+			JOIN stories s ON s.hn_id = story_search.rowid
+			LEFT JOIN story_metadata m ON m.hn_id = s.hn_id
+			WHERE story_search MATCH ?
+				AND s.created_at >= ? AND s.created_at < ?
+			ORDER BY rank
+			LIMIT ? OFFSET ?
+		`
+		snippetArgs = []any{snippetOpen, snippetClose}
+	}
+	if match == "" {
+		return []SearchResult{}, 0, nil
+	}
+
+	from, to := int64(0), int64(1<<62)
+	if !p.From.IsZero() {
+		from = p.From.Unix()
+	}
+	if !p.To.IsZero() {
+		to = p.To.Unix()
+	}
+
+	var total int
+	err := st.queryRow(ctx, countQuery, match, from, to).Scan(&total)
+	if err != nil {
+		logger.Error("search count failed",
+			"event", "search_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return nil, 0, err
+	}
+
+	args := append(snippetArgs, match, from, to, p.Limit, p.Offset)
+	rows, err := st.query(ctx, searchQuery, args...)
+	if err != nil {
+		logger.Error("search query failed",
+			"event", "search_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0, p.Limit)
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(
+			&r.ID, &r.Title, &r.URL, &r.Time,
+			&r.Score, &r.By,
+			&r.Descendants,
+			&r.OGImage, &r.OGDescription,
+			&r.Stats.WordCount, &r.Stats.ReadingTimeMinutes,
+			&r.Stats.Language,
+			&r.Snippet,
+			&r.Rank,
+		); err != nil {
+			return nil, 0, err
+		}
+		r.Snippet = highlightSnippet(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	ids := make([]int, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	tags, err := st.tagsFor(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range results {
+		results[i].Tags = tags[results[i].ID]
+	}
+
+	logger.Info("search completed",
+		"event", "search_completed",
+		"match", match,
+		"total", total,
+		"returned", len(results),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+
+	return results, total, nil
+}
+
+// ftsQuery turns free-form user input into an FTS5 query in which every word
+// is a quoted phrase, so punctuation and FTS operators in the input cannot
+// cause syntax errors. A trailing * on a word is kept as a prefix match.
+func ftsQuery(q string) string {
+	terms := make([]string, 0)
+	for _, word := range strings.Fields(q) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.Trim(word, `"*`)
+		word = strings.ReplaceAll(word, `"`, `""`)
+		if word == "" {
+			continue
+		}
+		term := `"` + word + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// tsQuery is the PostgreSQL counterpart of ftsQuery. Words are reduced to
+// their letters and digits and combined with AND; a trailing * on a word
+// becomes a prefix match.
+func tsQuery(q string) string {
+	terms := make([]string, 0)
+	for _, word := range strings.Fields(q) {
+		prefix := strings.HasSuffix(word, "*")
+		parts := strings.FieldsFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, part := range parts {
+			if prefix && i == len(parts)-1 {
+				part += ":*"
+			}
+			terms = append(terms, part)
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, snippetOpen, "<mark>")
+	return strings.ReplaceAll(s, snippetClose, "</mark>")
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"hn30/backend/logging"
+	"time"
+)
+
+// ArticleStats describes the text behind a story's link. Language is an ISO
+// 639-1 code, or empty when it could not be detected reliably.
+type ArticleStats struct {
+	WordCount          int
+	ReadingTimeMinutes int
+	Language           string
+}
+
+// SaveArticleStats stores the stats for a story. They are kept apart from
+// the rest of the metadata, which the refresher rewrites on every pass.
+func (st *SQLStore) SaveArticleStats(ctx context.Context, id int, stats ArticleStats) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "save_article_stats",
+		"story_id", id,
+	)
+	start := time.Now()
+
+	_, err := st.exec(ctx, `
+		INSERT INTO story_metadata (
+			hn_id, word_count, reading_time_minutes, language, updated_at
+		) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hn_id) DO UPDATE SET
+			word_count = excluded.word_count,
+			reading_time_minutes = excluded.reading_time_minutes,
+			language = excluded.language
+		`,
+		id, stats.WordCount, stats.ReadingTimeMinutes, stats.Language, time.Now().Unix(),
+	)
+	if err != nil {
+		logger.Error("article stats save failed",
+			"event", "article_stats_save_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+
+	logger.Debug("article stats saved",
+		"event", "article_stats_saved",
+		"word_count", stats.WordCount,
+		"language", stats.Language,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return nil
+}
+
+func (m *MemoryStore) SaveArticleStats(ctx context.Context, id int, stats ArticleStats) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta := m.state.metadata[id]
+	meta.stats = stats
+	m.state.metadata[id] = meta
+	return nil
+}
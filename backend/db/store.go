@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hn30/backend/logging"
+	"hn30/backend/types"
+	"time"
+)
+
+// ErrNotFound is returned by Store lookups when the requested row does not
+// exist.
+var ErrNotFound = errors.New("db: not found")
+
+// Store is the persistence layer behind the refresher and the API handlers.
+// SQLStore (SQLite or PostgreSQL) is used in production, MemoryStore in
+// tests.
+type Store interface {
+	// Stories
+	UpsertStory(ctx context.Context, s types.Story) error
+	UpsertStoryMetadata(ctx context.Context, s types.Story, ogImage, ogDescription string) error
+	GetStory(ctx context.Context, id int) (StoredStory, error)
+	SaveArticleStats(ctx context.Context, id int, stats ArticleStats) error
+	SetStoryTags(ctx context.Context, id int, tags []string) error
+
+	// Snapshots
+	RecordSnapshot(ctx context.Context, s types.Story, rank int, takenAt time.Time) error
+	Archive(ctx context.Context, from, to time.Time) ([]ArchiveEntry, error)
+
+	// Summaries
+	SaveSummary(ctx context.Context, id int, summary StoredSummary) error
+	GetSummary(ctx context.Context, id int) (StoredSummary, error)
+	Search(ctx context.Context, p SearchParams) ([]SearchResult, int, error)
+
+	// Embeddings
+	SaveEmbedding(ctx context.Context, id int, e StoryEmbedding) error
+	GetEmbedding(ctx context.Context, id int) (StoryEmbedding, error)
+	SimilarStories(ctx context.Context, e StoryEmbedding, excludeID, limit int) ([]SimilarStory, error)
+
+	// Notifications
+	ShouldNotify(ctx context.Context, s types.Story) (bool, error)
+	MarkNotified(ctx context.Context, storyID int) error
+
+	// LLM usage
+	RecordUsage(ctx context.Context, u UsageRecord) error
+	UsageTotals(ctx context.Context, from, to time.Time) (UsageTotals, error)
+	UsageByDay(ctx context.Context, from, to time.Time) ([]UsageDay, error)
+
+	// Retention
+	Prune(ctx context.Context, policy RetentionPolicy, now time.Time) (PruneResult, error)
+
+	// WithTx runs fn against a Store whose writes are committed together
+	// if fn returns nil and discarded otherwise. Nested calls join the
+	// outer transaction.
+	WithTx(ctx context.Context, fn func(Store) error) error
+
+	// Ping checks that the database is reachable.
+	Ping(ctx context.Context) error
+
+	Close() error
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// Stories are pushed once they have been on Hacker News for at least
+// notifyMinAge and reached notifyMinPoints.
+const (
+	notifyMinAge    = time.Hour
+	notifyMinPoints = 600
+)
+
+// StoredStory is a story as persisted in the stories table, joined with the
+// metadata captured the last time it was processed by the refresher.
+type StoredStory struct {
+	types.Story
+	OGImage       string
+	OGDescription string
+	Stats         ArticleStats
+	Tags          []string
+}
+
+// notificationEligible decides whether a story should trigger a push
+// notification, given what the store knows about it. Shared by all Store
+// implementations so they agree on the rules.
+func notificationEligible(s types.Story, notified bool, notifiedAt, createdTime int64, maxPoints int) bool {
+	logger := logging.L().With(
+		"event_type", "notification_check",
+		"story_id", s.ID,
+		"story_title", s.Title,
+		"story_score", s.Score,
+	)
+
+	now := time.Now().Unix()
+	age := now - createdTime
+
+	logger.Debug("story data retrieved",
+		"event", "data_retrieved",
+		"notified_at", notifiedAt,
+		"notified_at_valid", notified,
+		"created_at", createdTime,
+		"max_points", maxPoints,
+		"age_seconds", age,
+		"current_time", now,
+	)
+
+	if notified {
+		logger.Debug("notification already sent",
+			"event", "notification_check_completed",
+			"reason", "already_notified",
+			"notified_at_timestamp", notifiedAt,
+			"eligible", false,
+		)
+		return false
+	}
+
+	if age < int64(notifyMinAge.Seconds()) {
+		logger.Debug("story too new",
+			"event", "notification_check_completed",
+			"reason", "too_new",
+			"age_seconds", age,
+			"required_age_seconds", int64(notifyMinAge.Seconds()),
+			"eligible", false,
+		)
+		return false
+	}
+
+	if maxPoints < notifyMinPoints {
+		logger.Debug("insufficient points",
+			"event", "notification_check_completed",
+			"reason", "insufficient_points",
+			"max_points", maxPoints,
+			"required_points", notifyMinPoints,
+			"eligible", false,
+		)
+		return false
+	}
+
+	logger.Info("story eligible for notification",
+		"event", "notification_check_completed",
+		"reason", "eligible",
+		"age_seconds", age,
+		"max_points", maxPoints,
+		"eligible", true,
+	)
+
+	return true
+}
+
+func logNotificationQueryFailed(s types.Story, err error) {
+	logging.L().Warn("notification check query failed",
+		"event_type", "notification_check",
+		"event", "query_failed",
+		"story_id", s.ID,
+		"error", err,
+		"eligible", false,
+	)
+}
+
+// querier is the subset of *sql.DB and *sql.Tx the SQLite store needs, so
+// the same methods run inside and outside a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLStore implements Store on SQLite or PostgreSQL. Queries are written
+// with ? placeholders and rebound for the dialect; the few statements that
+// differ between the two are chosen per dialect.
+type SQLStore struct {
+	db      *sql.DB
+	q       querier
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+// NewSQLiteStore wraps a connection returned by Open.
+func NewSQLiteStore(conn *sql.DB) *SQLStore {
+	return &SQLStore{db: conn, q: conn, dialect: SQLite}
+}
+
+// NewPostgresStore wraps a connection returned by Connect for a PostgreSQL
+// DSN.
+func NewPostgresStore(conn *sql.DB) *SQLStore {
+	return &SQLStore{db: conn, q: conn, dialect: Postgres}
+}
+
+// OpenStore connects to the database selected by dsn (see DialectFor),
+// applies pending migrations and returns the matching store.
+func OpenStore(dsn string) *SQLStore {
+	conn, dialect := Connect(dsn, true)
+	return &SQLStore{db: conn, q: conn, dialect: dialect}
+}
+
+func (st *SQLStore) Dialect() Dialect {
+	return st.dialect
+}
+
+func (st *SQLStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return st.q.ExecContext(ctx, st.dialect.rebind(query), args...)
+}
+
+func (st *SQLStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return st.q.QueryContext(ctx, st.dialect.rebind(query), args...)
+}
+
+func (st *SQLStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return st.q.QueryRowContext(ctx, st.dialect.rebind(query), args...)
+}
+
+func (st *SQLStore) WithTx(ctx context.Context, fn func(Store) error) error {
+	if st.tx != nil {
+		return fn(st)
+	}
+
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLStore{db: st.db, q: tx, tx: tx, dialect: st.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *SQLStore) Ping(ctx context.Context) error {
+	return st.db.PingContext(ctx)
+}
+
+func (st *SQLStore) Close() error {
+	if st.tx != nil {
+		return nil
+	}
+	return st.db.Close()
+}
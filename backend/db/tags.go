@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"hn30/backend/logging"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SetStoryTags replaces the topic tags of a story.
+func (st *SQLStore) SetStoryTags(ctx context.Context, id int, tags []string) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "set_story_tags",
+		"story_id", id,
+	)
+	start := time.Now()
+
+	err := st.WithTx(ctx, func(txStore Store) error {
+		tx := txStore.(*SQLStore)
+		if _, err := tx.exec(ctx, `DELETE FROM story_tags WHERE hn_id = ?`, id); err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			if _, err := tx.exec(ctx, `
+				INSERT INTO story_tags (hn_id, tag) VALUES (?, ?)
+				ON CONFLICT (hn_id, tag) DO NOTHING
+			`, id, tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("story tags save failed",
+			"event", "story_tags_save_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+
+	logger.Debug("story tags saved",
+		"event", "story_tags_saved",
+		"tags", tags,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return nil
+}
+
+// storyTags returns the tags of a story in alphabetical order.
+func (st *SQLStore) storyTags(ctx context.Context, id int) ([]string, error) {
+	rows, err := st.query(ctx, `SELECT tag FROM story_tags WHERE hn_id = ? ORDER BY tag`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// tagsFor returns the tags of several stories at once, keyed by story, each
+// in alphabetical order.
+func (st *SQLStore) tagsFor(ctx context.Context, ids []int) (map[int][]string, error) {
+	tags := make(map[int][]string)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	// Archive entries repeat a story once per day.
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := st.query(ctx, `
+		SELECT hn_id, tag FROM story_tags
+		WHERE hn_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY hn_id, tag
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
+
+func (m *MemoryStore) SetStoryTags(ctx context.Context, id int, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(tags) == 0 {
+		delete(m.state.tags, id)
+		return nil
+	}
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	m.state.tags[id] = slices.Compact(sorted)
+	return nil
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"hn30/backend/logging"
+	"sort"
+	"time"
+)
+
+// UsageRecord is the token count and cost of one LLM request. StoryID is 0
+// when the request was not made for a story. Operation is what the request
+// was for, such as generate_summary.
+type UsageRecord struct {
+	StoryID          int
+	Operation        string
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	CreatedAt        time.Time
+}
+
+// UsageTotals sums the usage recorded in a time range.
+type UsageTotals struct {
+	Requests         int
+	PromptTokens     int64
+	CompletionTokens int64
+	CostUSD          float64
+}
+
+// UsageDay is the usage of one model for one operation on one UTC day.
+type UsageDay struct {
+	Day       string
+	Operation string
+	Model     string
+	UsageTotals
+}
+
+// RecordUsage stores the accounting for one LLM request.
+func (st *SQLStore) RecordUsage(ctx context.Context, u UsageRecord) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "database_operation",
+		"operation", "record_usage",
+		"story_id", u.StoryID,
+	)
+	start := time.Now()
+
+	var storyID any
+	if u.StoryID != 0 {
+		storyID = u.StoryID
+	}
+
+	_, err := st.exec(ctx, `
+		INSERT INTO llm_usage (
+			hn_id, operation, provider, model, prompt_tokens, completion_tokens, cost_usd, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+		storyID, u.Operation, u.Provider, u.Model, u.PromptTokens, u.CompletionTokens, u.CostUSD, u.CreatedAt.Unix(),
+	)
+	if err != nil {
+		logger.Error("usage insert failed",
+			"event", "usage_record_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+
+	logger.Debug("usage recorded",
+		"event", "usage_recorded",
+		"usage_operation", u.Operation,
+		"model", u.Model,
+		"cost_usd", u.CostUSD,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return nil
+}
+
+// UsageTotals sums the usage recorded in [from, to).
+func (st *SQLStore) UsageTotals(ctx context.Context, from, to time.Time) (UsageTotals, error) {
+	var t UsageTotals
+	err := st.queryRow(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(cost_usd), 0)
+		FROM llm_usage
+		WHERE created_at >= ? AND created_at < ?
+	`, from.Unix(), to.Unix()).Scan(&t.Requests, &t.PromptTokens, &t.CompletionTokens, &t.CostUSD)
+	return t, err
+}
+
+// UsageByDay returns the usage recorded in [from, to) per UTC day,
+// operation and model, ordered by day, operation and then model.
+func (st *SQLStore) UsageByDay(ctx context.Context, from, to time.Time) ([]UsageDay, error) {
+	rows, err := st.query(ctx, `
+		SELECT
+			`+st.dialect.utcDay("created_at")+` AS day,
+			operation,
+			model,
+			COUNT(*),
+			SUM(prompt_tokens),
+			SUM(completion_tokens),
+			SUM(cost_usd)
+		FROM llm_usage
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY day, operation, model
+		ORDER BY day ASC, operation ASC, model ASC
+	`, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make([]UsageDay, 0)
+	for rows.Next() {
+		var d UsageDay
+		if err := rows.Scan(&d.Day, &d.Operation, &d.Model, &d.Requests, &d.PromptTokens, &d.CompletionTokens, &d.CostUSD); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+func (m *MemoryStore) RecordUsage(ctx context.Context, u UsageRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state.usage = append(m.state.usage, u)
+	return nil
+}
+
+func (m *MemoryStore) UsageTotals(ctx context.Context, from, to time.Time) (UsageTotals, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var t UsageTotals
+	for _, u := range m.state.usage {
+		if inUsageRange(u, from, to) {
+			t.add(u)
+		}
+	}
+	return t, nil
+}
+
+func (m *MemoryStore) UsageByDay(ctx context.Context, from, to time.Time) ([]UsageDay, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byKey := make(map[[3]string]*UsageDay)
+	for _, u := range m.state.usage {
+		if !inUsageRange(u, from, to) {
+			continue
+		}
+		key := [3]string{time.Unix(u.CreatedAt.Unix(), 0).UTC().Format(time.DateOnly), u.Operation, u.Model}
+		d, ok := byKey[key]
+		if !ok {
+			d = &UsageDay{Day: key[0], Operation: key[1], Model: key[2]}
+			byKey[key] = d
+		}
+		d.add(u)
+	}
+
+	days := make([]UsageDay, 0, len(byKey))
+	for _, d := range byKey {
+		days = append(days, *d)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Day != days[j].Day {
+			return days[i].Day < days[j].Day
+		}
+		if days[i].Operation != days[j].Operation {
+			return days[i].Operation < days[j].Operation
+		}
+		return days[i].Model < days[j].Model
+	})
+	return days, nil
+}
+
+func inUsageRange(u UsageRecord, from, to time.Time) bool {
+	ts := u.CreatedAt.Unix()
+	return ts >= from.Unix() && ts < to.Unix()
+}
+
+func (t *UsageTotals) add(u UsageRecord) {
+	t.Requests++
+	t.PromptTokens += int64(u.PromptTokens)
+	t.CompletionTokens += int64(u.CompletionTokens)
+	t.CostUSD += u.CostUSD
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-shiori/go-readability"
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	// maxDocumentSize bounds what is downloaded for one link. Papers with
+	// embedded figures are routinely several megabytes.
+	maxDocumentSize = 20 << 20
+
+	// maxDocumentText bounds the text kept from PDFs and plain text files,
+	// which unlike web pages have no boilerplate stripped and can run to
+	// book length.
+	maxDocumentText = 100_000
+
+	maxDescriptionLength = 200
+)
+
+// Document kinds, as told apart by documentKind.
+const (
+	kindHTML     = "html"
+	kindPDF      = "pdf"
+	kindText     = "text"
+	kindMarkdown = "markdown"
+)
+
+var (
+	errUnsupportedDocument = errors.New("unsupported content type")
+	errDocumentTooLarge    = fmt.Errorf("document larger than %d bytes", maxDocumentSize)
+)
+
+// document is the readable content of a link.
+type document struct {
+	Kind  string
+	Title string
+	Text  string
+	// PageCount is only known for PDFs.
+	PageCount int
+}
+
+// documentKind decides how to read a response from its Content-Type, falling
+// back to the first bytes of the body and the file extension when the server
+// does not say. Responses without a usable type are read as HTML, as they
+// always were. An empty kind means the content cannot be read at all.
+func documentKind(contentType string, u *url.URL, head []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	ext := ""
+	if u != nil {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return kindHTML
+	case "application/pdf", "application/x-pdf":
+		return kindPDF
+	case "text/markdown", "text/x-markdown":
+		return kindMarkdown
+	case "text/plain":
+		// Raw files on code hosts are served as text/plain whatever they are.
+		if ext == ".md" || ext == ".markdown" {
+			return kindMarkdown
+		}
+		return kindText
+	case "", "application/octet-stream", "binary/octet-stream":
+		switch {
+		case bytes.HasPrefix(head, []byte("%PDF-")):
+			return kindPDF
+		case ext == ".pdf":
+			return kindPDF
+		case ext == ".md" || ext == ".markdown":
+			return kindMarkdown
+		case ext == ".txt":
+			return kindText
+		}
+		return kindHTML
+	}
+	return ""
+}
+
+// readDocument reads a response body of the given kind. base is the final
+// URL of the response, used to resolve links in HTML.
+func readDocument(kind string, body io.Reader, base *url.URL) (document, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxDocumentSize+1))
+	if err != nil {
+		return document{}, err
+	}
+	if len(data) > maxDocumentSize {
+		return document{}, errDocumentTooLarge
+	}
+
+	switch kind {
+	case kindHTML:
+		article, err := readability.FromReader(bytes.NewReader(data), base)
+		if err != nil {
+			return document{}, err
+		}
+		return document{Kind: kindHTML, Title: article.Title, Text: article.TextContent}, nil
+	case kindPDF:
+		return readPDF(data)
+	case kindText, kindMarkdown:
+		if !utf8.Valid(data) {
+			return document{}, errors.New("text is not valid UTF-8")
+		}
+		return readPlainText(kind, string(data)), nil
+	}
+	return document{}, errUnsupportedDocument
+}
+
+// readPDF extracts the text of every page. The parser panics on some
+// malformed files, so panics are turned into errors.
+func readPDF(data []byte) (doc document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = document{}, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return document{}, err
+	}
+
+	doc = document{
+		Kind:      kindPDF,
+		Title:     strings.TrimSpace(r.Trailer().Key("Info").Key("Title").Text()),
+		PageCount: r.NumPage(),
+	}
+
+	var text strings.Builder
+	fonts := make(map[string]*pdf.Font)
+	for i := 1; i <= doc.PageCount && text.Len() < maxDocumentText; i++ {
+		page := r.Page(i)
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := page.Font(name)
+				fonts[name] = &f
+			}
+		}
+		pageText, err := page.GetPlainText(fonts)
+		if err != nil {
+			return document{}, fmt.Errorf("page %d: %w", i, err)
+		}
+		text.WriteString(strings.TrimSpace(pageText))
+		text.WriteString("\n\n")
+	}
+	doc.Text = truncateText(strings.TrimSpace(text.String()), maxDocumentText)
+	return doc, nil
+}
+
+// readPlainText passes text through unchanged. The title is the first
+// Markdown heading, or the first line of a text file if it is short enough
+// to be one.
+func readPlainText(kind, text string) document {
+	doc := document{Kind: kind, Text: truncateText(strings.TrimSpace(text), maxDocumentText)}
+	for _, line := range strings.Split(doc.Text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if kind == kindMarkdown {
+			if title, ok := strings.CutPrefix(line, "# "); ok {
+				doc.Title = strings.TrimSpace(title)
+				break
+			}
+			continue
+		}
+		if utf8.RuneCountInString(line) <= 120 {
+			doc.Title = line
+		}
+		break
+	}
+	return doc
+}
+
+// description is shown in place of og:description for documents that have
+// none: the title and length of a PDF, or the opening paragraph of a text.
+func (d document) description() string {
+	switch d.Kind {
+	case kindPDF:
+		meta := "PDF"
+		if d.PageCount == 1 {
+			meta += ", 1 page"
+		} else if d.PageCount > 1 {
+			meta += fmt.Sprintf(", %d pages", d.PageCount)
+		}
+		if d.Title == "" {
+			return meta
+		}
+		return fmt.Sprintf("%s (%s)", d.Title, meta)
+	case kindText, kindMarkdown:
+		for _, para := range strings.Split(d.Text, "\n\n") {
+			para = strings.Join(strings.Fields(para), " ")
+			if para == "" || para == d.Title || isMarkdownDecoration(para) {
+				continue
+			}
+			return truncateText(para, maxDescriptionLength)
+		}
+	}
+	return ""
+}
+
+// isMarkdownDecoration reports whether a paragraph is a heading, badge, image
+// or HTML block rather than prose.
+func isMarkdownDecoration(para string) bool {
+	for _, prefix := range []string{"#", "<", "![", "[!["} {
+		if strings.HasPrefix(para, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateText cuts s to at most limit bytes without splitting a character,
+// marking the cut with an ellipsis.
+func truncateText(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit - len("…")
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(s[:cut]) + "…"
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testPDF builds a minimal PDF with one line of text per page.
+func testPDF(title string, pages ...string) []byte {
+	var objects []string
+	add := func(obj string) int {
+		objects = append(objects, obj)
+		return len(objects)
+	}
+
+	catalog := add("")
+	tree := add("")
+	font := add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	var kids []string
+	for _, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		content := add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+		page := add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>", tree, font, content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	objects[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", tree)
+	objects[tree-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+	info := add(fmt.Sprintf("<< /Title (%s) >>", title))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, info, xref)
+	return buf.Bytes()
+}
+
+func TestDocumentKind(t *testing.T) {
+	tests := []struct {
+		contentType string
+		url         string
+		head        string
+		want        string
+	}{
+		{"text/html; charset=utf-8", "https://example.com/", "", kindHTML},
+		{"application/xhtml+xml", "https://example.com/", "", kindHTML},
+		{"application/pdf", "https://arxiv.org/pdf/1706.03762", "", kindPDF},
+		{"application/octet-stream", "https://example.com/paper", "%PDF-1.7", kindPDF},
+		{"", "https://example.com/paper.PDF", "", kindPDF},
+		{"text/markdown", "https://example.com/notes", "", kindMarkdown},
+		{"text/plain; charset=utf-8", "https://raw.example.com/README.md", "", kindMarkdown},
+		{"text/plain", "https://example.com/rfc.txt", "", kindText},
+		{"", "https://example.com/", "<p>hi</p>", kindHTML},
+		{"image/png", "https://example.com/chart.png", "", ""},
+		{"application/zip", "https://example.com/src.zip", "", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := documentKind(tt.contentType, u, []byte(tt.head)); got != tt.want {
+			t.Errorf("documentKind(%q, %q, %q) = %q, want %q", tt.contentType, tt.url, tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestReadPDF(t *testing.T) {
+	doc, err := readDocument(kindPDF, bytes.NewReader(testPDF("Attention Is All You Need", "First page text", "Second page text")), nil)
+	if err != nil {
+		t.Fatalf("readDocument: %v", err)
+	}
+	if doc.Title != "Attention Is All You Need" || doc.PageCount != 2 {
+		t.Errorf("title %q, pages %d", doc.Title, doc.PageCount)
+	}
+	if !strings.Contains(doc.Text, "First page text") || !strings.Contains(doc.Text, "Second page text") {
+		t.Errorf("text = %q", doc.Text)
+	}
+	if got, want := doc.description(), "Attention Is All You Need (PDF, 2 pages)"; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+
+	if _, err := readDocument(kindPDF, strings.NewReader("%PDF-1.4 truncated"), nil); err == nil {
+		t.Error("malformed PDF: expected an error")
+	}
+}
+
+func TestReadPlainText(t *testing.T) {
+	md := readPlainText(kindMarkdown, "<!-- badge -->\n\n# Project\n\nA small tool\nfor large jobs.\n\n## Usage\n")
+	if md.Title != "Project" {
+		t.Errorf("markdown title = %q", md.Title)
+	}
+	if got := md.description(); got != "A small tool for large jobs." {
+		t.Errorf("markdown description = %q", got)
+	}
+
+	txt := readPlainText(kindText, "\nRFC 9110: HTTP Semantics\n\nAbstract text.")
+	if txt.Title != "RFC 9110: HTTP Semantics" {
+		t.Errorf("text title = %q", txt.Title)
+	}
+	if got := readPlainText(kindText, strings.Repeat("word ", 50)).Title; got != "" {
+		t.Errorf("long first line used as title: %q", got)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("héllo wörld", 8); got != "héll…" {
+		t.Errorf("truncateText = %q", got)
+	}
+	if got := truncateText("short", 10); got != "short" {
+		t.Errorf("truncateText = %q", got)
+	}
+}
+
+func TestExtractArticleTextNonHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/paper":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(testPDF("A Paper", "Results are good"))
+		case "/README.md":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("# Tool\n\nDoes things."))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		}
+	}))
+	defer server.Close()
+
+	text, err := extractArticleText(context.Background(), server.URL+"/paper")
+	if err != nil || !strings.Contains(text, "Results are good") {
+		t.Errorf("pdf: text %q, err %v", text, err)
+	}
+	text, err = extractArticleText(context.Background(), server.URL+"/README.md")
+	if err != nil || text != "# Tool\n\nDoes things." {
+		t.Errorf("markdown: text %q, err %v", text, err)
+	}
+	if _, err := extractArticleText(context.Background(), server.URL+"/image"); err == nil {
+		t.Error("image: expected an error")
+	}
+
+	_, description, err := getOGData(context.Background(), server.URL+"/paper")
+	if err != nil || description != "A Paper (PDF, 1 page)" {
+		t.Errorf("og data for pdf: description %q, err %v", description, err)
+	}
+}
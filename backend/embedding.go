@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"hn30/backend/db"
+	"hn30/backend/logging"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// localEmbeddingDimensions is the size of the local embedder's vectors.
+	// Larger vectors have fewer hash collisions and cost more to compare.
+	localEmbeddingDimensions = 512
+
+	defaultRelatedLimit = 5
+	maxRelatedLimit     = 20
+)
+
+// embedder turns story text into a vector. Vectors are only compared with
+// others from the same Model.
+type embedder interface {
+	Model() string
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// embeddingsFromEnv reads EMBEDDINGS: "local" (the default) hashes words
+// into vectors without any external service, "off" disables related
+// stories, and provider:model uses an OpenAI-compatible embeddings API
+// configured like the LLM_PROVIDERS entries, e.g. "openai:text-embedding-3-small".
+func embeddingsFromEnv() (embedder, error) {
+	switch v := os.Getenv("EMBEDDINGS"); v {
+	case "", "local":
+		return localEmbedder{dimensions: localEmbeddingDimensions}, nil
+	case "off":
+		return nil, nil
+	default:
+		chain, err := parseLLMChain(v)
+		if err != nil {
+			return nil, fmt.Errorf("EMBEDDINGS: %w", err)
+		}
+		if len(chain) != 1 {
+			return nil, fmt.Errorf("EMBEDDINGS takes a single provider:model, got %q", v)
+		}
+		return &openAIEmbedder{provider: chain[0].Provider, model: chain[0].Model}, nil
+	}
+}
+
+// embeddings is set at startup; nil when EMBEDDINGS is off.
+var embeddings embedder
+
+// localEmbedder hashes words and word pairs into a fixed number of
+// dimensions. It only finds stories that share vocabulary, but needs no
+// model or network.
+type localEmbedder struct {
+	dimensions int
+}
+
+func (e localEmbedder) Model() string {
+	return fmt.Sprintf("local-hash-%d", e.dimensions)
+}
+
+// embeddingStopwords carry no topic and would make every story look alike.
+var embeddingStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "has": true, "have": true, "how": true, "i": true, "in": true, "is": true,
+	"it": true, "its": true, "my": true, "new": true, "of": true, "on": true, "or": true, "our": true,
+	"show": true, "hn": true, "ask": true, "that": true, "the": true, "this": true, "to": true, "was": true,
+	"we": true, "what": true, "when": true, "why": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+func (e localEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	var words []string
+	for _, w := range strings.Fields(normalizeWords(text)) {
+		if embeddingStopwords[w] {
+			continue
+		}
+		// A crude plural fold, so "compiler" and "compilers" match.
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = w[:len(w)-1]
+		}
+		words = append(words, w)
+	}
+
+	v := make([]float32, e.dimensions)
+	add := func(feature string) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		// The top bit picks the sign so collisions tend to cancel out.
+		if sum&(1<<31) != 0 {
+			v[int(sum%uint32(e.dimensions))]--
+		} else {
+			v[int(sum%uint32(e.dimensions))]++
+		}
+	}
+	for i, w := range words {
+		add(w)
+		if i > 0 {
+			add(words[i-1] + " " + w)
+		}
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range v {
+			v[i] *= scale
+		}
+	}
+	return v, nil
+}
+
+// openAIEmbedder calls the /embeddings endpoint of an OpenAI-compatible API.
+type openAIEmbedder struct {
+	provider *llmProvider
+	model    string
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.provider.Name + ":" + e.model
+}
+
+type embeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	apiKey := os.Getenv(e.provider.KeyEnv)
+	if apiKey == "" && e.provider.isBuiltin() {
+		return nil, fmt.Errorf("%s not set", e.provider.KeyEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, llm.Timeout)
+	defer cancel()
+
+	body, _ := json.Marshal(embeddingRequest{Model: e.model, Input: text})
+	req, err := http.NewRequestWithContext(ctx, "POST", e.provider.BaseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	res, err := llmClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("%s returned status %d: %s", e.provider.Name, res.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var parsed embeddingResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decoding %s embedding: %w", e.provider.Name, err)
+	}
+	if len(parsed.Data) == 0 || len(parsed.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("%s returned no embedding", e.provider.Name)
+	}
+	return parsed.Data[0].Embedding, nil
+}
+
+// embeddingText is what a story is embedded from: its title and summary, or
+// its description until someone asks for a summary.
+func embeddingText(story EnrichedStory) string {
+	if story.Summary != "" {
+		return story.Title + "\n\n" + story.Summary
+	}
+	return story.Title + "\n\n" + story.OGDescription
+}
+
+// embedStory returns the story's embedding, computing and saving it unless
+// one from the current model is already stored. force recomputes it, for
+// when the story's text has changed.
+func embedStory(ctx context.Context, story EnrichedStory, force bool) (db.StoryEmbedding, error) {
+	model := embeddings.Model()
+	if !force {
+		stored, err := store.GetEmbedding(ctx, story.ID)
+		if err == nil && stored.Model == model {
+			return stored, nil
+		}
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return db.StoryEmbedding{}, err
+		}
+	}
+
+	logger := logging.FromContext(ctx).With(
+		"event_type", "embedding",
+		"story_id", story.ID,
+		"model", model,
+	)
+	start := time.Now()
+
+	vector, err := embeddings.Embed(ctx, embeddingText(story))
+	if err != nil {
+		logger.Error("embedding failed",
+			"event", "embedding_failed",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return db.StoryEmbedding{}, err
+	}
+
+	e := db.StoryEmbedding{Model: model, Vector: vector}
+	if err := store.SaveEmbedding(ctx, story.ID, e); err != nil {
+		return e, err
+	}
+	logger.Debug("story embedded",
+		"event", "story_embedded",
+		"dimensions", len(vector),
+		"with_summary", story.Summary != "",
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return e, nil
+}
+
+// embeddingJob is a background embedding of one story; done is closed
+// when it ends.
+type embeddingJob struct {
+	done chan struct{}
+}
+
+// embeddingsInFlight holds the latest background embedding of each story,
+// so repeated requests for a story start one embedding.
+var (
+	embeddingsMu       sync.Mutex
+	embeddingsInFlight = make(map[int]*embeddingJob)
+)
+
+// embedInBackground embeds the story off the request path. Stories that are
+// not stored are left alone: SimilarStories only finds stored stories, so
+// their embedding would never be used. force re-embeds a story whose text
+// has changed. It waits for a running embedding of the story to finish
+// first, so the newer text is the one saved last.
+func embedInBackground(ctx context.Context, story EnrichedStory, force bool) {
+	if embeddings == nil {
+		return
+	}
+
+	embeddingsMu.Lock()
+	prev := embeddingsInFlight[story.ID]
+	if prev != nil && !force {
+		embeddingsMu.Unlock()
+		return
+	}
+	job := &embeddingJob{done: make(chan struct{})}
+	embeddingsInFlight[story.ID] = job
+	embeddingsMu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() {
+			close(job.done)
+			embeddingsMu.Lock()
+			if embeddingsInFlight[story.ID] == job {
+				delete(embeddingsInFlight, story.ID)
+			}
+			embeddingsMu.Unlock()
+		}()
+		if prev != nil {
+			<-prev.done
+		}
+
+		if _, err := store.GetStory(ctx, story.ID); err != nil {
+			if !errors.Is(err, db.ErrNotFound) {
+				logging.FromContext(ctx).Warn("story lookup before embedding failed",
+					"event_type", "embedding",
+					"event", "embedding_lookup_failed",
+					"story_id", story.ID,
+					"error", err,
+				)
+			}
+			return
+		}
+		embedCtx, span := tracer.Start(ctx, "embed.story")
+		_, err := embedStory(embedCtx, story, force)
+		endSpan(span, err)
+	}()
+}
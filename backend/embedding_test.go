@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dot is the cosine similarity of unit vectors.
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestLocalEmbedder(t *testing.T) {
+	e := localEmbedder{dimensions: localEmbeddingDimensions}
+	embed := func(text string) []float32 {
+		v, err := e.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatalf("embed %q: %v", text, err)
+		}
+		return v
+	}
+
+	rust := embed("Writing a Rust compiler backend for RISC-V")
+	compilers := embed("Show HN: RISC-V compilers written in Rust")
+	baking := embed("The science of sourdough baking")
+
+	if got := dot(rust, rust); got < 0.999 || got > 1.001 {
+		t.Errorf("expected unit vectors, got self-similarity %f", got)
+	}
+	if near, far := dot(rust, compilers), dot(rust, baking); near <= far || near < 0.3 {
+		t.Errorf("expected the compiler stories to be closer: %f vs %f", near, far)
+	}
+	if v := embed("the and of"); dot(v, v) != 0 {
+		t.Error("expected stopwords alone to give a zero vector")
+	}
+}
+
+func TestEmbeddingsFromEnv(t *testing.T) {
+	t.Setenv("EMBEDDINGS", "")
+	if e, err := embeddingsFromEnv(); err != nil || e.Model() != "local-hash-512" {
+		t.Errorf("default: %v, %v", e, err)
+	}
+	t.Setenv("EMBEDDINGS", "off")
+	if e, err := embeddingsFromEnv(); err != nil || e != nil {
+		t.Errorf("off: %v, %v", e, err)
+	}
+	t.Setenv("EMBEDDINGS", "openai:text-embedding-3-small")
+	if e, err := embeddingsFromEnv(); err != nil || e.Model() != "openai:text-embedding-3-small" {
+		t.Errorf("openai: %v, %v", e, err)
+	}
+	t.Setenv("EMBEDDINGS", "openai:a,openai:b")
+	if _, err := embeddingsFromEnv(); err == nil {
+		t.Error("expected an error for more than one provider")
+	}
+	t.Setenv("EMBEDDINGS", "ollama:nomic-embed-text")
+	if _, err := embeddingsFromEnv(); err == nil {
+		t.Error("expected an error for a provider without a base URL")
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/embeddings" || req.Model != "nomic-embed-text" || req.Input != "hello" {
+			t.Errorf("unexpected request %s %+v", r.URL.Path, req)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("authorization = %q", got)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]any{{"embedding": []float32{0.25, -0.5, 1}}},
+		})
+	}))
+	defer srv.Close()
+	t.Setenv("LLM_PROVIDER_OLLAMA_BASE_URL", srv.URL)
+	t.Setenv("LLM_PROVIDER_OLLAMA_API_KEY", "secret")
+	t.Setenv("EMBEDDINGS", "ollama:nomic-embed-text")
+
+	e, err := embeddingsFromEnv()
+	if err != nil {
+		t.Fatalf("embeddingsFromEnv: %v", err)
+	}
+	v, err := e.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(v) != 3 || v[0] != 0.25 || v[1] != -0.5 || v[2] != 1 {
+		t.Errorf("vector = %v", v)
+	}
+}
+
+// waitForEmbedding waits for the background embedding of a story to end.
+func waitForEmbedding(t *testing.T, id int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		embeddingsMu.Lock()
+		_, running := embeddingsInFlight[id]
+		embeddingsMu.Unlock()
+		if !running {
+			return
+		}
+	}
+	t.Fatalf("story %d is still being embedded", id)
+}
+
+// blockingEmbedder holds back embeddings of text without a summary until
+// release is closed, and marks summary-based vectors with a 1.
+type blockingEmbedder struct {
+	release chan struct{}
+}
+
+func (e blockingEmbedder) Model() string { return "blocking" }
+
+func (e blockingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if strings.Contains(text, "summary") {
+		return []float32{1}, nil
+	}
+	<-e.release
+	return []float32{0}, nil
+}
+
+func TestEmbedInBackgroundSavesSummaryLast(t *testing.T) {
+	origStore, origEmbeddings := store, embeddings
+	t.Cleanup(func() { store, embeddings = origStore, origEmbeddings })
+	store = db.NewMemoryStore()
+	release := make(chan struct{})
+	embeddings = blockingEmbedder{release: release}
+
+	ctx := context.Background()
+	story := EnrichedStory{Story: types.Story{ID: 7, Title: "Slow to embed"}}
+	if err := store.UpsertStory(ctx, story.Story); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+
+	embedInBackground(ctx, story, false)
+	story.Summary = "A summary."
+	embedInBackground(ctx, story, true)
+	// A later plain request does not queue a third run.
+	embedInBackground(ctx, story, false)
+	close(release)
+	waitForEmbedding(t, 7)
+
+	e, err := store.GetEmbedding(ctx, 7)
+	if err != nil || len(e.Vector) != 1 || e.Vector[0] != 1 {
+		t.Errorf("expected the summary embedding to win, got %+v, %v", e, err)
+	}
+}
+
+func TestRelatedHandler(t *testing.T) {
+	origStore, origCache, origEmbeddings := store, storyCache, embeddings
+	t.Cleanup(func() { store, storyCache, embeddings = origStore, origCache, origEmbeddings })
+	store = db.NewMemoryStore()
+	storyCache = NewCache()
+	embeddings = localEmbedder{dimensions: localEmbeddingDimensions}
+
+	ctx := context.Background()
+	for _, s := range []EnrichedStory{
+		{Story: types.Story{ID: 1, Title: "SQLite is not a toy database"}},
+		{Story: types.Story{ID: 2, Title: "Scaling SQLite to many concurrent writers"}},
+		{Story: types.Story{ID: 3, Title: "A history of the bicycle"}},
+	} {
+		if err := store.UpsertStory(ctx, s.Story); err != nil {
+			t.Fatalf("upsert story: %v", err)
+		}
+		if _, err := embedStory(ctx, s, false); err != nil {
+			t.Fatalf("embed story: %v", err)
+		}
+	}
+	// A story nobody has embedded yet is embedded in the background, and
+	// related stories are found once it is.
+	current := EnrichedStory{Story: types.Story{ID: 4, Title: "Why we moved from Postgres to SQLite"}}
+	if err := store.UpsertStory(ctx, current.Story); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+	storyCache.Set(4, current)
+
+	type response struct {
+		StoryID int            `json:"storyId"`
+		Related []RelatedStory `json:"related"`
+		Pending bool           `json:"pending"`
+	}
+	related := func(id int) response {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/story/%d/related", id), nil)
+		req.SetPathValue("id", strconv.Itoa(id))
+		relatedHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var resp response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if resp := related(4); !resp.Pending || len(resp.Related) != 0 {
+		t.Fatalf("expected an empty pending list, got %+v", resp)
+	}
+	waitForEmbedding(t, 4)
+	resp := related(4)
+	if resp.StoryID != 4 || resp.Pending || len(resp.Related) < 2 {
+		t.Fatalf("expected the two SQLite stories, got %+v", resp)
+	}
+	for _, r := range resp.Related[:2] {
+		if r.ID != 1 && r.ID != 2 {
+			t.Errorf("unexpected related story %d (%f)", r.ID, r.Similarity)
+		}
+	}
+
+	// A story that is only known live is not embedded: nothing would ever
+	// find its vector.
+	storyCache.Set(5, EnrichedStory{Story: types.Story{ID: 5, Title: "SQLite in production"}})
+	if resp := related(5); !resp.Pending {
+		t.Errorf("expected a pending list, got %+v", resp)
+	}
+	waitForEmbedding(t, 5)
+	if _, err := store.GetEmbedding(ctx, 5); err != db.ErrNotFound {
+		t.Errorf("expected no embedding for an unstored story, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/story/4/related?limit=100", nil)
+	req.SetPathValue("id", "4")
+	relatedHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a limit over the maximum, got %d", rec.Code)
+	}
+
+	embeddings = nil
+	rec = httptest.NewRecorder()
+	relatedHandler(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with embeddings off, got %d", rec.Code)
+	}
+}
+
+func TestRefreshEmbedsWithConfiguredEmbedder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/topstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[1]`)
+	})
+	mux.HandleFunc("/item/1.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"title":"Ask HN: Favourite compilers?","text":"Which ones?","score":50,"by":"pg","time":%d}`, time.Now().Unix())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	origBaseURL, origDelay, origPush, origOnRefresh := hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh
+	origCache, origStore, origEmbeddings := storyCache, store, embeddings
+	t.Cleanup(func() {
+		hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh = origBaseURL, origDelay, origPush, origOnRefresh
+		storyCache, store, embeddings = origCache, origStore, origEmbeddings
+	})
+	hnBaseURL = server.URL
+	scrapeDelay = 0
+	pushNotification = func(ctx context.Context, s EnrichedStory) {}
+	articleStatsOnRefresh = false
+
+	for _, tt := range []struct {
+		env   string
+		model string
+	}{
+		{"off", ""},
+		{"local", "local-hash-512"},
+	} {
+		t.Setenv("EMBEDDINGS", tt.env)
+		var err error
+		if embeddings, err = embeddingsFromEnv(); err != nil {
+			t.Fatal(err)
+		}
+		storyCache = NewCache()
+		store = db.NewMemoryStore()
+
+		refreshCache()
+
+		e, err := store.GetEmbedding(context.Background(), 1)
+		if tt.model == "" && err == nil {
+			t.Errorf("EMBEDDINGS=%s: expected no embedding, got %s", tt.env, e.Model)
+		}
+		if tt.model != "" && (err != nil || e.Model != tt.model) {
+			t.Errorf("EMBEDDINGS=%s: expected a %s embedding, got %q, %v", tt.env, tt.model, e.Model, err)
+		}
+	}
+}
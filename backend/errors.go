@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"hn30/backend/logging"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorResponse is the body of every error returned by the API. Code is a
+// stable machine-readable identifier, Message is meant for people.
+// RetryAfter is set in seconds when retrying later may succeed, matching the
+// Retry-After header.
+type ErrorResponse struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// writeError replies to r with status and a JSON ErrorResponse.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorRetryAfter(w, r, status, code, message, 0)
+}
+
+// writeErrorRetryAfter is writeError with a Retry-After hint, rounded up to
+// whole seconds. A zero retryAfter omits the hint.
+func writeErrorRetryAfter(w http.ResponseWriter, r *http.Request, status int, code, message string, retryAfter time.Duration) {
+	resp := ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: logging.RequestID(r.Context()),
+	}
+	if retryAfter > 0 {
+		resp.RetryAfter = int(math.Ceil(retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// notFoundHandler answers requests that match no route.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "not_found", "No such endpoint")
+}
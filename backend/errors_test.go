@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorEnvelopeCarriesRequestID(t *testing.T) {
+	handler := requestIDMiddleware(http.HandlerFunc(storyHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/story/abc", nil)
+	req.SetPathValue("id", "abc")
+	req.Header.Set("X-Request-ID", "edge-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "edge-42" {
+		t.Errorf("expected the incoming request ID to be echoed, got %q", got)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error body: %v", err)
+	}
+	if resp.Code != "invalid_story_id" || resp.RequestID != "edge-42" || resp.Message == "" {
+		t.Errorf("unexpected error body %+v", resp)
+	}
+}
+
+func TestRequestIDReplacesInvalidHeader(t *testing.T) {
+	handler := requestIDMiddleware(http.HandlerFunc(notFoundHandler))
+
+	for _, incoming := range []string{"", "has spaces", strings.Repeat("a", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/nope", nil)
+		req.Header.Set("X-Request-ID", incoming)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get("X-Request-ID")
+		if got == "" || got == incoming {
+			t.Errorf("expected %q to be replaced with a generated ID, got %q", incoming, got)
+		}
+		var resp ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding error body: %v", err)
+		}
+		if resp.Code != "not_found" || resp.RequestID != got {
+			t.Errorf("unexpected error body %+v", resp)
+		}
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	handler := requestIDMiddleware(rateLimitMiddleware("summarize", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	var rec *httptest.ResponseRecorder
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/api/summarize", nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+	}
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the second request to be limited, got %d", rec.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error body: %v", err)
+	}
+	if resp.Code != "rate_limited" || resp.RetryAfter < 1 || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a retry hint, got %+v (Retry-After %q)", resp, rec.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Overridable in tests.
+var (
+	githubAPIBaseURL = "https://api.github.com"
+	arxivAPIBaseURL  = "https://export.arxiv.org/api/query"
+	youtubeBaseURL   = "https://www.youtube.com"
+)
+
+// siteExtractor reads links that generic extraction handles poorly, usually
+// through the site's own API. Extract is only called for URLs Match accepts.
+type siteExtractor struct {
+	Name    string
+	Match   func(u *url.URL) bool
+	Extract func(ctx context.Context, u *url.URL) (document, error)
+}
+
+// siteExtractors are tried in order before a link is fetched and parsed
+// generically. To support another site, add an entry here.
+var siteExtractors = []siteExtractor{
+	{Name: "github", Match: matchGitHubRepo, Extract: extractGitHubReadme},
+	{Name: "arxiv", Match: matchArxiv, Extract: extractArxivAbstract},
+	{Name: "youtube", Match: matchYouTube, Extract: extractYouTubeVideo},
+}
+
+func findSiteExtractor(u *url.URL) (siteExtractor, bool) {
+	for _, e := range siteExtractors {
+		if e.Match(u) {
+			return e, true
+		}
+	}
+	return siteExtractor{}, false
+}
+
+// siteGet fetches target and returns the body of a 200 response.
+func siteGet(ctx context.Context, target string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("User-Agent", customUserAgent)
+
+	resp, err := summarizerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: status %d", target, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
+
+// hostIs reports whether u is on one of hosts, ignoring a leading "www.".
+func hostIs(u *url.URL, hosts ...string) bool {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, h := range hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// pathSegments splits the path of u, dropping empty segments.
+func pathSegments(u *url.URL) []string {
+	var segments []string
+	for _, s := range strings.Split(u.Path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// Ask HN, Show HN and other self posts are linked to their item page, which
+// only has the text buried in comment markup. The item fetched from the API
+// during refresh has it on its own.
+
+// selfPostDocument is the text of a self post, or an empty document if the
+// item has none.
+func selfPostDocument(item *hnItem) document {
+	if item.Text == "" {
+		return document{}
+	}
+	text, err := htmlToText(item.Text)
+	if err != nil || text == "" {
+		return document{}
+	}
+	return document{Kind: kindText, Title: item.Title, Text: item.Title + "\n\n" + text}
+}
+
+// htmlToText flattens the limited HTML Hacker News allows in item text,
+// keeping paragraph breaks.
+func htmlToText(s string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(strings.ReplaceAll(s, "<p>", "\n\n<p>")))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(doc.Text()), nil
+}
+
+// Repository pages are mostly file listings and navigation; the README is
+// what describes the project.
+
+func matchGitHubRepo(u *url.URL) bool {
+	return hostIs(u, "github.com") && len(pathSegments(u)) == 2
+}
+
+func extractGitHubReadme(ctx context.Context, u *url.URL) (document, error) {
+	segments := pathSegments(u)
+	repo := segments[0] + "/" + strings.TrimSuffix(segments[1], ".git")
+
+	header := http.Header{"Accept": {"application/vnd.github.raw+json"}}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	body, err := siteGet(ctx, fmt.Sprintf("%s/repos/%s/readme", githubAPIBaseURL, repo), header)
+	if err != nil {
+		return document{}, err
+	}
+
+	doc := readPlainText(kindMarkdown, string(body))
+	if doc.Text == "" {
+		return document{}, errors.New("empty README")
+	}
+	if doc.Title == "" {
+		doc.Title = repo
+	}
+	doc.Text = "Repository: " + repo + "\n\n" + doc.Text
+	return doc, nil
+}
+
+// arXiv links usually point at the abstract page or straight at the PDF; the
+// abstract is the author's own summary and far shorter than the paper.
+
+var arxivIDPattern = regexp.MustCompile(`^(\d{4}\.\d{4,5}|[a-z-]+(\.[A-Z]{2})?/\d{7})(v\d+)?$`)
+
+func arxivID(u *url.URL) string {
+	segments := pathSegments(u)
+	if len(segments) < 2 || (segments[0] != "abs" && segments[0] != "pdf") {
+		return ""
+	}
+	id := strings.TrimSuffix(strings.Join(segments[1:], "/"), ".pdf")
+	if !arxivIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+func matchArxiv(u *url.URL) bool {
+	return hostIs(u, "arxiv.org", "export.arxiv.org") && arxivID(u) != ""
+}
+
+func extractArxivAbstract(ctx context.Context, u *url.URL) (document, error) {
+	id := arxivID(u)
+	body, err := siteGet(ctx, arxivAPIBaseURL+"?id_list="+url.QueryEscape(id), nil)
+	if err != nil {
+		return document{}, err
+	}
+
+	var feed struct {
+		Entries []struct {
+			Title   string `xml:"title"`
+			Summary string `xml:"summary"`
+			Authors []struct {
+				Name string `xml:"name"`
+			} `xml:"author"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return document{}, err
+	}
+	if len(feed.Entries) == 0 || strings.TrimSpace(feed.Entries[0].Summary) == "" {
+		return document{}, fmt.Errorf("no abstract for arXiv %s", id)
+	}
+
+	entry := feed.Entries[0]
+	title := strings.Join(strings.Fields(entry.Title), " ")
+	authors := make([]string, 0, len(entry.Authors))
+	for _, a := range entry.Authors {
+		authors = append(authors, a.Name)
+	}
+	abstract := strings.Join(strings.Fields(entry.Summary), " ")
+
+	return document{
+		Kind:  kindText,
+		Title: title,
+		Text:  fmt.Sprintf("%s\n\nAuthors: %s\n\nAbstract: %s", title, strings.Join(authors, ", "), abstract),
+	}, nil
+}
+
+// Video pages are almost entirely script; the title and the description the
+// uploader wrote are all there is to summarize.
+
+var youtubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+func youtubeVideoID(u *url.URL) string {
+	var id string
+	switch {
+	case hostIs(u, "youtu.be"):
+		if segments := pathSegments(u); len(segments) > 0 {
+			id = segments[0]
+		}
+	case hostIs(u, "youtube.com", "m.youtube.com"):
+		segments := pathSegments(u)
+		switch {
+		case len(segments) == 1 && segments[0] == "watch":
+			id = u.Query().Get("v")
+		case len(segments) == 2 && (segments[0] == "shorts" || segments[0] == "live" || segments[0] == "embed"):
+			id = segments[1]
+		}
+	}
+	if !youtubeIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+func matchYouTube(u *url.URL) bool {
+	return youtubeVideoID(u) != ""
+}
+
+// youtubeDescriptionPattern finds the full description in the player data
+// embedded in the watch page; the meta tags only carry the first lines.
+var youtubeDescriptionPattern = regexp.MustCompile(`"shortDescription":("(?:[^"\\]|\\.)*")`)
+
+func extractYouTubeVideo(ctx context.Context, u *url.URL) (document, error) {
+	header := http.Header{"Accept-Language": {"en-US,en;q=0.9"}}
+	body, err := siteGet(ctx, youtubeBaseURL+"/watch?v="+youtubeVideoID(u), header)
+	if err != nil {
+		return document{}, err
+	}
+
+	page, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return document{}, err
+	}
+	title, _ := page.Find("meta[property='og:title']").Attr("content")
+	description, _ := page.Find("meta[property='og:description']").Attr("content")
+	if m := youtubeDescriptionPattern.FindSubmatch(body); m != nil {
+		var full string
+		if err := json.Unmarshal(m[1], &full); err == nil && full != "" {
+			description = full
+		}
+	}
+	if title == "" {
+		return document{}, errors.New("no video title found")
+	}
+
+	text := "Video: " + title
+	if description != "" {
+		text += "\n\nDescription:\n" + description
+	}
+	return document{Kind: kindText, Title: title, Text: text}, nil
+}
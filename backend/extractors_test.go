@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFindSiteExtractor(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		// Self posts get their text from the item fetched during refresh.
+		{"https://news.ycombinator.com/item?id=8863", ""},
+		{"https://github.com/golang/go", "github"},
+		{"https://www.github.com/golang/go.git", "github"},
+		{"https://github.com/golang/go/issues/1", ""},
+		{"https://arxiv.org/abs/1706.03762", "arxiv"},
+		{"https://arxiv.org/pdf/1706.03762v7.pdf", "arxiv"},
+		{"https://arxiv.org/abs/hep-th/9711200", "arxiv"},
+		{"https://arxiv.org/list/cs.AI/recent", ""},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube"},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", "youtube"},
+		{"https://m.youtube.com/shorts/dQw4w9WgXcQ", "youtube"},
+		{"https://www.youtube.com/@golang", ""},
+		{"https://example.com/abs/1706.03762", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		e, _ := findSiteExtractor(u)
+		if e.Name != tt.want {
+			t.Errorf("findSiteExtractor(%q) = %q, want %q", tt.url, e.Name, tt.want)
+		}
+	}
+}
+
+func TestSiteExtractors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/golang/go/readme":
+			if r.Header.Get("Accept") != "application/vnd.github.raw+json" {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			w.Write([]byte("# The Go Programming Language\n\nGo is an open source programming language."))
+		case "/api/query":
+			if r.URL.Query().Get("id_list") != "1706.03762v7" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"><entry>
+				<title>Attention Is All
+				  You Need</title>
+				<summary>  The dominant sequence transduction models
+				  are based on recurrent networks.</summary>
+				<author><name>Ashish Vaswani</name></author>
+				<author><name>Noam Shazeer</name></author>
+			</entry></feed>`))
+		case "/watch":
+			w.Write([]byte(`<html><head>
+				<meta property="og:title" content="Rick Astley - Never Gonna Give You Up">
+				<meta property="og:description" content="The official video...">
+				</head><body><script>var ytInitialPlayerResponse = {"videoDetails":{"shortDescription":"The official video for \"Never Gonna Give You Up\"\nby Rick Astley."}};</script></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	origGitHub, origArxiv, origYouTube := githubAPIBaseURL, arxivAPIBaseURL, youtubeBaseURL
+	t.Cleanup(func() {
+		githubAPIBaseURL, arxivAPIBaseURL, youtubeBaseURL = origGitHub, origArxiv, origYouTube
+	})
+	githubAPIBaseURL, arxivAPIBaseURL, youtubeBaseURL = server.URL, server.URL+"/api/query", server.URL
+
+	tests := []struct {
+		url       string
+		wantTitle string
+		wantText  []string
+	}{
+		{
+			"https://github.com/golang/go",
+			"The Go Programming Language",
+			[]string{"Repository: golang/go", "Go is an open source programming language."},
+		},
+		{
+			"https://arxiv.org/pdf/1706.03762v7",
+			"Attention Is All You Need",
+			[]string{"Authors: Ashish Vaswani, Noam Shazeer", "Abstract: The dominant sequence transduction models are based on recurrent networks."},
+		},
+		{
+			"https://youtu.be/dQw4w9WgXcQ",
+			"Rick Astley - Never Gonna Give You Up",
+			[]string{"Video: Rick Astley", "Description:\nThe official video for \"Never Gonna Give You Up\"\nby Rick Astley."},
+		},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		e, ok := findSiteExtractor(u)
+		if !ok {
+			t.Fatalf("%s: no extractor", tt.url)
+		}
+		doc, err := e.Extract(context.Background(), u)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if doc.Title != tt.wantTitle {
+			t.Errorf("%s: title %q, want %q", tt.url, doc.Title, tt.wantTitle)
+		}
+		for _, want := range tt.wantText {
+			if !strings.Contains(doc.Text, want) {
+				t.Errorf("%s: text %q does not contain %q", tt.url, doc.Text, want)
+			}
+		}
+	}
+}
+
+func TestSelfPostDocument(t *testing.T) {
+	item := &hnItem{
+		Story: types.Story{ID: 8863, Title: "Ask HN: Is this useful?"},
+		Text:  `First paragraph with a <a href="https:&#x2F;&#x2F;example.com">link</a>.<p>Second &amp; last.`,
+	}
+	doc := selfPostDocument(item)
+	if want := "Ask HN: Is this useful?\n\nFirst paragraph with a link.\n\nSecond & last."; doc.Text != want {
+		t.Errorf("text = %q, want %q", doc.Text, want)
+	}
+	if got := doc.description(); got != "First paragraph with a link." {
+		t.Errorf("description = %q", got)
+	}
+	if got := selfPostDocument(&hnItem{Story: types.Story{Title: "A link"}}); got.Text != "" {
+		t.Errorf("expected no text for a link, got %q", got.Text)
+	}
+}
+
+func TestExtractArticleTextFallsBackToPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("The page itself."))
+	}))
+	defer server.Close()
+
+	orig := siteExtractors
+	t.Cleanup(func() { siteExtractors = orig })
+	siteExtractors = []siteExtractor{{
+		Name:  "broken",
+		Match: func(u *url.URL) bool { return true },
+		Extract: func(ctx context.Context, u *url.URL) (document, error) {
+			return document{}, errors.New("api down")
+		},
+	}}
+
+	text, err := extractArticleText(context.Background(), server.URL)
+	if err != nil || text != "The page itself." {
+		t.Errorf("text %q, err %v", text, err)
+	}
+}
@@ -1,19 +1,216 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"hn30/backend/utils"
+	"errors"
+	"hn30/backend/db"
+	"hn30/backend/logging"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxArchiveRangeDays caps /api/archive range queries so a single request
+// cannot scan the whole snapshot history.
+const maxArchiveRangeDays = 31
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
 )
 
+type ArchiveStory struct {
+	EnrichedStory
+	PeakPoints  int   `json:"peakPoints"`
+	BestRank    int   `json:"bestRank"`
+	FirstSeenAt int64 `json:"firstSeenAt"`
+	LastSeenAt  int64 `json:"lastSeenAt"`
+	Appearances int   `json:"appearances"`
+}
+
+type SearchResult struct {
+	EnrichedStory
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// RelatedStory is a previously seen story close to the one asked about.
+type RelatedStory struct {
+	EnrichedStory
+	Similarity float64 `json:"similarity"`
+}
+
+type BackupResponse struct {
+	Path      string   `json:"path"`
+	SizeBytes int64    `json:"sizeBytes"`
+	CreatedAt int64    `json:"createdAt"`
+	Pruned    []string `json:"pruned"`
+}
+
+type UsageTotalsResponse struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	CostUSD          float64 `json:"costUsd"`
+}
+
+type UsageDayResponse struct {
+	Date      string `json:"date"`
+	Operation string `json:"operation"`
+	Model     string `json:"model"`
+	UsageTotalsResponse
+}
+
+type BudgetResponse struct {
+	DailyUSD          float64 `json:"dailyUsd"`
+	MonthlyUSD        float64 `json:"monthlyUsd"`
+	SpentTodayUSD     float64 `json:"spentTodayUsd"`
+	SpentThisMonthUSD float64 `json:"spentThisMonthUsd"`
+	Exceeded          bool    `json:"exceeded"`
+}
+
+type UsageResponse struct {
+	From   string              `json:"from"`
+	To     string              `json:"to"`
+	Totals UsageTotalsResponse `json:"totals"`
+	Days   []UsageDayResponse  `json:"days"`
+	Budget BudgetResponse      `json:"budget"`
+}
+
+type ArchiveDay struct {
+	Date    string         `json:"date"`
+	Stories []ArchiveStory `json:"stories"`
+}
+
 func topStoriesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
 	w.Header().Set("Content-Type", "application/json")
 	stories := storyCache.GetAll()
+
+	// ?tag= narrows the list to one topic.
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		if !isTopic(tag) {
+			writeError(w, r, http.StatusBadRequest, "invalid_tag",
+				"Unknown tag, expected one of: "+strings.Join(topicTags(), ", "))
+			return
+		}
+		tagged := make([]EnrichedStory, 0, len(stories))
+		for _, s := range stories {
+			if slices.Contains(s.Tags, tag) {
+				tagged = append(tagged, s)
+			}
+		}
+		stories = tagged
+	}
+
 	json.NewEncoder(w).Encode(stories)
 }
 
+func storyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, r, http.StatusBadRequest, "invalid_story_id", "Invalid story ID")
+		return
+	}
+
+	story, source, err := findStory(r.Context(), id)
+	if err == errStoryNotFound {
+		writeError(w, r, http.StatusNotFound, "story_not_found", "Story not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "upstream_unavailable", "Failed to fetch story")
+		return
+	}
+
+	w.Header().Set("X-Story-Source", source)
+	json.NewEncoder(w).Encode(story)
+}
+
+// relatedHandler serves the stories whose embeddings are nearest to the
+// story's own. A story without an embedding from the current model gets an
+// empty list marked pending while it is embedded in the background.
+func relatedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
+	w.Header().Set("Content-Type", "application/json")
+
+	if embeddings == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "embeddings_disabled", "Related stories are disabled")
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, r, http.StatusBadRequest, "invalid_story_id", "Invalid story ID")
+		return
+	}
+	limit := defaultRelatedLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRelatedLimit {
+			writeError(w, r, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	story, _, err := findStory(r.Context(), id)
+	if err == errStoryNotFound {
+		writeError(w, r, http.StatusNotFound, "story_not_found", "Story not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "upstream_unavailable", "Failed to fetch story")
+		return
+	}
+
+	e, err := store.GetEmbedding(r.Context(), id)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		writeError(w, r, http.StatusInternalServerError, "related_failed", "Failed to find related stories")
+		return
+	}
+	if err != nil || e.Model != embeddings.Model() {
+		embedInBackground(r.Context(), story, false)
+		json.NewEncoder(w).Encode(map[string]any{
+			"storyId": id,
+			"model":   embeddings.Model(),
+			"related": []RelatedStory{},
+			"pending": true,
+		})
+		return
+	}
+
+	similar, err := store.SimilarStories(r.Context(), e, id, limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "related_failed", "Failed to find related stories")
+		return
+	}
+
+	related := make([]RelatedStory, 0, len(similar))
+	for _, s := range similar {
+		related = append(related, RelatedStory{
+			EnrichedStory: storedToEnriched(s.StoredStory),
+			Similarity:    s.Similarity,
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"storyId": id,
+		"model":   e.Model,
+		"related": related,
+		"pending": false,
+	})
+}
+
 func summarizeHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
 	w.Header().Set("Content-Type", "application/json")
@@ -21,52 +218,462 @@ func summarizeHandler(w http.ResponseWriter, r *http.Request) {
 	// 1. Get and validate the story ID from the query params
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
-		http.Error(w, "Missing story ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "missing_story_id", "Missing story ID")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid story ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid_story_id", "Invalid story ID")
 		return
 	}
 
+	logger := logging.FromContext(r.Context()).With(
+		"event_type", "summarize",
+		"story_id", id,
+	)
+
 	// 2. Check if the story exists in the cache
 	story, found := storyCache.Get(id)
 	if !found {
-		http.Error(w, "Story not found", http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, "story_not_found", "Story not found")
 		return
 	}
 
-	// 3. If summary already exists, return it immediately
-	if story.Summary != "" {
-		utils.LogComponent("CACHE", "Returning cached summary for story %d", id)
+	// 3. If summary already exists, return it immediately. Summaries
+	// written with another prompt version are regenerated.
+	prompt := summaryPrompt
+	if story.Summary != "" && story.SummaryPromptVersion == prompt.Version {
+		logger.Debug("returning cached summary",
+			"event", "summary_cache_hit",
+		)
 		json.NewEncoder(w).Encode(map[string]string{"summary": story.Summary, "model": story.SummaryModel})
 		return
 	}
 
-	// 4. If no summary, generate one
-	utils.LogComponent("SUMMARIZER", "No summary found for story %d, generating...", id)
-	articleText, err := extractArticleText(story.URL)
+	// 4. Summaries survive restarts in the database, reuse a stored one
+	stored, err := store.GetSummary(r.Context(), id)
+	if err == nil && stored.PromptVersion == prompt.Version {
+		logger.Debug("returning stored summary",
+			"event", "summary_store_hit",
+		)
+		story.Summary = stored.Summary
+		story.ArticleText = stored.ArticleText
+		story.SummaryModel = stored.Model
+		story.SummaryPromptVersion = stored.PromptVersion
+		ensureArticleStats(r.Context(), &story, stored.ArticleText)
+		storyCache.Set(id, story)
+		json.NewEncoder(w).Encode(map[string]string{"summary": stored.Summary, "model": stored.Model})
+		return
+	}
+
+	// 5. If no summary, generate one
+	logger.Info("no summary found, generating",
+		"event", "summary_miss",
+		"prompt_version", prompt.Version,
+		"outdated_prompt_version", stored.PromptVersion,
+	)
+
+	// Stop spending once the LLM budget is used up. Stored summaries above
+	// are still served.
+	if llmBudget.DailyUSD > 0 || llmBudget.MonthlyUSD > 0 {
+		status, err := checkBudget(r.Context(), store, llmBudget, time.Now())
+		if err != nil {
+			logger.Error("budget check failed, allowing summary",
+				"event", "budget_check_failed",
+				"error", err,
+			)
+		} else if status.Exceeded {
+			logger.Warn("llm budget exhausted",
+				"event", "budget_exceeded",
+				"period", status.Period,
+				"spent_today_usd", status.SpentTodayUSD,
+				"spent_this_month_usd", status.SpentThisMonthUSD,
+			)
+			writeErrorRetryAfter(w, r, http.StatusServiceUnavailable, "budget_exceeded",
+				"Summaries are paused until the "+status.Period+" budget resets", status.ResetIn)
+			return
+		}
+	}
+
+	// The work is kept when the client goes away so the summary is still
+	// saved for the next reader.
+	ctx := context.WithoutCancel(r.Context())
+
+	// An outdated summary still has the article text, as does a story whose
+	// stats were computed on refresh, which saves fetching the page again.
+	articleText := stored.ArticleText
+	if articleText == "" {
+		articleText = story.ArticleText
+	}
+	if articleText == "" {
+		extractCtx, extractSpan := tracer.Start(ctx, "summarize.extract_article", trace.WithAttributes(
+			attribute.Int("story.id", id),
+			attribute.String("url.full", story.URL),
+		))
+		articleText, err = extractArticleText(extractCtx, story.URL)
+		endSpan(extractSpan, err)
+		if err != nil {
+			logger.Error("article extraction failed",
+				"event", "summary_extraction_failed",
+				"error", err,
+			)
+			writeError(w, r, http.StatusInternalServerError, "extraction_failed", "Failed to extract article content")
+			return
+		}
+	}
+
+	ensureArticleStats(ctx, &story, articleText)
+
+	rendered, err := prompt.Render(summaryPromptData(story, articleText))
 	if err != nil {
-		utils.LogError("Failed to extract article text for story %d: %v", id, err)
-		http.Error(w, "Failed to extract article content", http.StatusInternalServerError)
+		logger.Error("prompt rendering failed",
+			"event", "prompt_render_failed",
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, "summary_failed", err.Error())
 		return
 	}
 
-	summary, err := generateSummary(articleText)
+	llmCtx, llmSpan := tracer.Start(ctx, "summarize.llm", trace.WithAttributes(
+		attribute.Int("story.id", id),
+		attribute.Int("summarize.article_length", len(articleText)),
+		attribute.String("summarize.prompt_version", prompt.Version),
+	))
+	summary, err := generateSummary(llmCtx, rendered)
+	llmSpan.SetAttributes(attribute.String("gen_ai.response.model", summary.Model))
+	endSpan(llmSpan, err)
 	if err != nil {
-		utils.LogError("Failed to generate summary for story %d: %v", id, err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error("summary generation failed",
+			"event", "summary_generation_failed",
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, "summary_failed", err.Error())
 		return
 	}
 
-	// 5. Save the new summary and article text to the cache
+	recordUsage(ctx, id, opGenerateSummary, summary)
+
+	// 6. Save the new summary and article text to the cache and database
 	story.Summary = summary.Summary
 	story.ArticleText = articleText
 	story.SummaryModel = summary.Model
+	story.SummaryPromptVersion = prompt.Version
 	storyCache.Set(id, story)
-	utils.LogComponent("CACHE", "Saved new summary for story %d to cache", id)
 
-	// 6. Return the new summary
+	if err := store.SaveSummary(ctx, id, db.StoredSummary{
+		Summary:       summary.Summary,
+		Model:         summary.Model,
+		ArticleText:   articleText,
+		PromptVersion: prompt.Version,
+	}); err != nil {
+		logger.Error("summary persist failed",
+			"event", "summary_persist_failed",
+			"error", err,
+		)
+	}
+
+	// The summary says more about the story than its description, so
+	// related stories are found from it from now on.
+	embedInBackground(ctx, story, true)
+
+	// 7. Return the new summary
 	json.NewEncoder(w).Encode(map[string]string{"summary": summary.Summary, "model": summary.Model})
 }
+
+// archiveHandler serves the stories that were on our front page on a given
+// UTC day (?date=YYYY-MM-DD) or for each day of a range (?from=...&to=...),
+// ranked by the peak points each story reached that day.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	single := query.Get("date") != ""
+
+	var from, to time.Time
+	var err error
+	if single {
+		from, err = time.Parse(time.DateOnly, query.Get("date"))
+		to = from
+	} else {
+		from, err = time.Parse(time.DateOnly, query.Get("from"))
+		if err == nil {
+			to, err = time.Parse(time.DateOnly, query.Get("to"))
+		}
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_date", "Expected date or from/to in YYYY-MM-DD format")
+		return
+	}
+	if to.Before(from) {
+		writeError(w, r, http.StatusBadRequest, "invalid_range", "to must not be before from")
+		return
+	}
+	if to.Sub(from) >= maxArchiveRangeDays*24*time.Hour {
+		writeError(w, r, http.StatusBadRequest, "range_too_large", "Range must not exceed 31 days")
+		return
+	}
+
+	entries, err := store.Archive(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "archive_failed", "Failed to load archive")
+		return
+	}
+
+	byDay := make(map[string][]ArchiveStory)
+	for _, e := range entries {
+		byDay[e.Day] = append(byDay[e.Day], ArchiveStory{
+			EnrichedStory: storedToEnriched(e.StoredStory),
+			PeakPoints:    e.PeakPoints,
+			BestRank:      e.BestRank,
+			FirstSeenAt:   e.FirstSeenAt,
+			LastSeenAt:    e.LastSeenAt,
+			Appearances:   e.Appearances,
+		})
+	}
+
+	days := make([]ArchiveDay, 0)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		stories := byDay[date]
+		if stories == nil {
+			stories = []ArchiveStory{}
+		}
+		days = append(days, ArchiveDay{Date: date, Stories: stories})
+	}
+
+	if single {
+		json.NewEncoder(w).Encode(days[0])
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"from": from.Format(time.DateOnly),
+		"to":   to.Format(time.DateOnly),
+		"days": days,
+	})
+}
+
+// searchHandler serves full-text search over every story the refresher has
+// seen: ?q= is required, from/to (YYYY-MM-DD, inclusive) filter on the HN
+// submission date and page/limit paginate.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_query", "Missing search query")
+		return
+	}
+
+	page, limit := 1, defaultSearchLimit
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "invalid_page", "Invalid page")
+			return
+		}
+		page = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			writeError(w, r, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	params := db.SearchParams{
+		Query:  q,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	}
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_date", "Invalid from date")
+			return
+		}
+		params.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_date", "Invalid to date")
+			return
+		}
+		params.To = to.AddDate(0, 0, 1)
+	}
+
+	found, total, err := store.Search(r.Context(), params)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "search_failed", "Search failed")
+		return
+	}
+
+	results := make([]SearchResult, 0, len(found))
+	for _, f := range found {
+		results = append(results, SearchResult{
+			EnrichedStory: storedToEnriched(f.StoredStory),
+			Snippet:       f.Snippet,
+			Rank:          f.Rank,
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"query":   q,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+		"results": results,
+	})
+}
+
+// backupHandler writes an on-demand database backup. It is mounted behind
+// adminAuthMiddleware.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	logger := logging.FromContext(r.Context()).With(
+		"event_type", "admin_backup",
+	)
+
+	cfg, err := backupConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid backup configuration",
+			"event", "backup_config_invalid",
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, "backup_misconfigured", "Invalid backup configuration")
+		return
+	}
+
+	backup, pruned, err := runBackup(r.Context(), store, cfg)
+	if errors.Is(err, db.ErrBackupUnsupported) {
+		writeError(w, r, http.StatusNotImplemented, "backup_unsupported", "Backups are not supported for this database")
+		return
+	}
+	if err != nil && backup.Path == "" {
+		logger.Error("backup failed",
+			"event", "admin_backup_failed",
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, "backup_failed", "Backup failed")
+		return
+	}
+	if err != nil {
+		// The backup itself succeeded; only pruning failed.
+		logger.Error("pruning old backups failed",
+			"event", "admin_backup_prune_failed",
+			"backup_path", backup.Path,
+			"error", err,
+		)
+	}
+
+	logger.Info("backup written",
+		"event", "admin_backup_completed",
+		"backup_path", backup.Path,
+		"size_bytes", backup.SizeBytes,
+		"pruned", len(pruned),
+	)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BackupResponse{
+		Path:      backup.Path,
+		SizeBytes: backup.SizeBytes,
+		CreatedAt: backup.CreatedAt.Unix(),
+		Pruned:    pruned,
+	})
+}
+
+// usageHandler reports LLM usage and cost between from and to (UTC days,
+// inclusive), by default the current month, along with the budget status.
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	now := time.Now().UTC()
+	_, _, monthStart, _ := usagePeriods(now)
+	from, to := monthStart, now.Truncate(24*time.Hour)
+
+	query := r.URL.Query()
+	var err error
+	if v := query.Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_date", "Invalid from date")
+			return
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_date", "Invalid to date")
+			return
+		}
+	}
+	if to.Before(from) {
+		writeError(w, r, http.StatusBadRequest, "invalid_range", "to must not be before from")
+		return
+	}
+
+	resp, err := usageReport(r.Context(), from, to, now)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("usage report failed",
+			"event_type", "admin_usage",
+			"event", "usage_report_failed",
+			"error", err,
+		)
+		writeError(w, r, http.StatusInternalServerError, "usage_failed", "Failed to load usage")
+		return
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+func usageReport(ctx context.Context, from, to, now time.Time) (UsageResponse, error) {
+	end := to.AddDate(0, 0, 1)
+	totals, err := store.UsageTotals(ctx, from, end)
+	if err != nil {
+		return UsageResponse{}, err
+	}
+	days, err := store.UsageByDay(ctx, from, end)
+	if err != nil {
+		return UsageResponse{}, err
+	}
+	status, err := checkBudget(ctx, store, llmBudget, now)
+	if err != nil {
+		return UsageResponse{}, err
+	}
+
+	resp := UsageResponse{
+		From:   from.Format(time.DateOnly),
+		To:     to.Format(time.DateOnly),
+		Totals: usageTotalsResponse(totals),
+		Days:   make([]UsageDayResponse, 0, len(days)),
+		Budget: BudgetResponse{
+			DailyUSD:          llmBudget.DailyUSD,
+			MonthlyUSD:        llmBudget.MonthlyUSD,
+			SpentTodayUSD:     status.SpentTodayUSD,
+			SpentThisMonthUSD: status.SpentThisMonthUSD,
+			Exceeded:          status.Exceeded,
+		},
+	}
+	for _, d := range days {
+		resp.Days = append(resp.Days, UsageDayResponse{
+			Date:                d.Day,
+			Operation:           d.Operation,
+			Model:               d.Model,
+			UsageTotalsResponse: usageTotalsResponse(d.UsageTotals),
+		})
+	}
+	return resp, nil
+}
+
+func usageTotalsResponse(t db.UsageTotals) UsageTotalsResponse {
+	return UsageTotalsResponse{
+		Requests:         t.Requests,
+		PromptTokens:     t.PromptTokens,
+		CompletionTokens: t.CompletionTokens,
+		CostUSD:          t.CostUSD,
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// processStartedAt is reported by /healthz as uptime.
+var processStartedAt = time.Now()
+
+// dbPingTimeout bounds the database check in /readyz so a hung database
+// fails the probe instead of blocking it.
+const dbPingTimeout = 2 * time.Second
+
+type HealthResponse struct {
+	Status        string  `json:"status"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+}
+
+type ReadinessCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status        string                    `json:"status"`
+	Checks        map[string]ReadinessCheck `json:"checks"`
+	LastRefreshAt int64                     `json:"lastRefreshAt,omitempty"`
+	CachedStories int                       `json:"cachedStories"`
+}
+
+// healthzHandler reports that the process is alive. It never touches
+// dependencies, so a slow database does not get the instance restarted.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(HealthResponse{
+		Status:        "ok",
+		UptimeSeconds: time.Since(processStartedAt).Seconds(),
+	})
+}
+
+// readyzHandler reports whether the instance should receive traffic: the
+// database answers, the first refresh has populated the cache, and the last
+// successful refresh is no older than twice the refresh interval.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp := ReadinessResponse{
+		Status: "ok",
+		Checks: make(map[string]ReadinessCheck),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dbPingTimeout)
+	defer cancel()
+	if store == nil {
+		resp.Checks["database"] = ReadinessCheck{Detail: "not initialized"}
+	} else if err := store.Ping(ctx); err != nil {
+		resp.Checks["database"] = ReadinessCheck{Detail: err.Error()}
+	} else {
+		resp.Checks["database"] = ReadinessCheck{OK: true}
+	}
+
+	var lastRefresh time.Time
+	if storyCache != nil {
+		lastRefresh = storyCache.LastUpdated()
+		resp.CachedStories = storyCache.Len()
+	}
+
+	if lastRefresh.IsZero() {
+		resp.Checks["cache"] = ReadinessCheck{Detail: "first refresh has not completed"}
+		resp.Checks["refresh"] = ReadinessCheck{Detail: "no successful refresh yet"}
+	} else {
+		resp.LastRefreshAt = lastRefresh.Unix()
+		resp.Checks["cache"] = ReadinessCheck{OK: true}
+
+		age := time.Since(lastRefresh).Round(time.Second)
+		if age > 2*refreshInterval {
+			resp.Checks["refresh"] = ReadinessCheck{Detail: "last successful refresh " + age.String() + " ago, limit " + (2 * refreshInterval).String()}
+		} else {
+			resp.Checks["refresh"] = ReadinessCheck{OK: true}
+		}
+	}
+
+	for _, c := range resp.Checks {
+		if !c.OK {
+			resp.Status = "unavailable"
+		}
+	}
+
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"hn30/backend/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() { storyCache, store = origCache, origStore })
+
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	probe := func() (int, ReadinessResponse) {
+		rec := httptest.NewRecorder()
+		readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp ReadinessResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding readiness: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := probe(); code != http.StatusServiceUnavailable || resp.Checks["cache"].OK {
+		t.Errorf("expected 503 before the first refresh, got %d %+v", code, resp)
+	}
+
+	storyCache.SetLastUpdated(time.Now())
+	if code, resp := probe(); code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("expected 200 after a refresh, got %d %+v", code, resp)
+	}
+
+	storyCache.SetLastUpdated(time.Now().Add(-3 * refreshInterval))
+	code, resp := probe()
+	if code != http.StatusServiceUnavailable || resp.Checks["refresh"].OK || !resp.Checks["database"].OK {
+		t.Errorf("expected only the refresh check to fail for a stale cache, got %d %+v", code, resp)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultLLMProviders reproduces the single model used before the
+	// chain was configurable.
+	defaultLLMProviders = "openrouter:@preset/hn30-summary"
+
+	defaultLLMTimeout = 60 * time.Second
+
+	llmBreakerThreshold = 3
+	llmBreakerCooldown  = time.Minute
+)
+
+// What an LLM request is for, in logs, the operation metric label and
+// usage records.
+const (
+	opGenerateSummary = "generate_summary"
+	opClassifyTopics  = "classify_topics"
+)
+
+// llmProvider is an OpenAI-compatible chat completions API. The key is read
+// from KeyEnv on every call, so it can be rotated without a restart.
+type llmProvider struct {
+	Name    string
+	BaseURL string
+	KeyEnv  string
+	breaker *circuitBreaker
+}
+
+func (p *llmProvider) isOpenRouter() bool {
+	return p.Name == "openrouter"
+}
+
+// isBuiltin reports whether p is a hosted API that always needs a key.
+func (p *llmProvider) isBuiltin() bool {
+	_, ok := builtinLLMProviders[p.Name]
+	return ok
+}
+
+// llmCandidate is one entry of the fallback chain. Price is set from
+// LLM_PRICES for models whose provider does not report what a request cost.
+type llmCandidate struct {
+	Provider *llmProvider
+	Model    string
+	Price    *llmPrice
+}
+
+// llmPrice is what a model charges in USD per million tokens.
+type llmPrice struct {
+	PromptUSD     float64
+	CompletionUSD float64
+}
+
+// cost estimates the cost of a request from its token counts.
+func (p llmPrice) cost(usage OpenRouterUsage) float64 {
+	return (float64(usage.PromptTokens)*p.PromptUSD + float64(usage.CompletionTokens)*p.CompletionUSD) / 1e6
+}
+
+// builtinLLMProviders need no configuration beyond their API key.
+var builtinLLMProviders = map[string]struct{ baseURL, keyEnv string }{
+	"openrouter": {"https://openrouter.ai/api/v1", "OPENROUTER_API_KEY"},
+	"openai":     {"https://api.openai.com/v1", "OPENAI_API_KEY"},
+}
+
+// llmConfig is read from the environment:
+//
+//	LLM_PROVIDERS  ordered provider:model pairs, e.g.
+//	               "openrouter:@preset/hn30-summary,openai:gpt-4o-mini"
+//	LLM_TIMEOUT    time allowed for each attempt (default 60s)
+//	LLM_PRICES     USD per million prompt/completion tokens for models whose
+//	               provider does not report cost, e.g.
+//	               "openai:gpt-4o-mini=0.15/0.60,local:llama3.1=0/0"
+//
+// Providers other than openrouter and openai are OpenAI-compatible servers
+// configured with LLM_PROVIDER_<NAME>_BASE_URL and, if they need one,
+// LLM_PROVIDER_<NAME>_API_KEY.
+type llmConfig struct {
+	Chain   []llmCandidate
+	Timeout time.Duration
+}
+
+func llmConfigFromEnv() (llmConfig, error) {
+	spec := os.Getenv("LLM_PROVIDERS")
+	if spec == "" {
+		spec = defaultLLMProviders
+	}
+	chain, err := parseLLMChain(spec)
+	if err != nil {
+		return llmConfig{}, fmt.Errorf("LLM_PROVIDERS: %w", err)
+	}
+
+	cfg := llmConfig{Chain: chain, Timeout: defaultLLMTimeout}
+	if v := os.Getenv("LLM_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return cfg, fmt.Errorf("LLM_TIMEOUT must be a positive duration, got %q", v)
+		}
+		cfg.Timeout = timeout
+	}
+	if v := os.Getenv("LLM_PRICES"); v != "" {
+		if err := parseLLMPrices(v, cfg.Chain); err != nil {
+			return cfg, fmt.Errorf("LLM_PRICES: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// parseLLMPrices parses comma-separated provider:model=prompt/completion
+// entries and sets the price on the matching entries of chain.
+func parseLLMPrices(spec string, chain []llmCandidate) error {
+	for _, entry := range strings.Split(spec, ",") {
+		pair, prices, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		promptRaw, completionRaw, ok2 := strings.Cut(prices, "/")
+		if !ok || !ok2 {
+			return fmt.Errorf("expected provider:model=prompt/completion, got %q", entry)
+		}
+		prompt, err1 := strconv.ParseFloat(promptRaw, 64)
+		completion, err2 := strconv.ParseFloat(completionRaw, 64)
+		if err1 != nil || err2 != nil || prompt < 0 || completion < 0 {
+			return fmt.Errorf("prices must be non-negative numbers, got %q", entry)
+		}
+
+		matched := false
+		for i, c := range chain {
+			if c.Provider.Name+":"+c.Model == pair {
+				chain[i].Price = &llmPrice{PromptUSD: prompt, CompletionUSD: completion}
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%q is not in LLM_PROVIDERS", pair)
+		}
+	}
+	return nil
+}
+
+// parseLLMChain parses comma-separated provider:model pairs. Only the first
+// colon separates the two, since model names may contain colons. Entries for
+// the same provider share one circuit breaker.
+func parseLLMChain(spec string) ([]llmCandidate, error) {
+	providers := make(map[string]*llmProvider)
+	var chain []llmCandidate
+
+	for _, entry := range strings.Split(spec, ",") {
+		name, model, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" || model == "" {
+			return nil, fmt.Errorf("expected provider:model, got %q", entry)
+		}
+
+		p, ok := providers[name]
+		if !ok {
+			p = &llmProvider{Name: name, breaker: newCircuitBreaker(llmBreakerThreshold, llmBreakerCooldown)}
+			if builtin, ok := builtinLLMProviders[name]; ok {
+				p.BaseURL, p.KeyEnv = builtin.baseURL, builtin.keyEnv
+			} else {
+				envName := "LLM_PROVIDER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+				p.BaseURL = strings.TrimSuffix(os.Getenv(envName+"_BASE_URL"), "/")
+				p.KeyEnv = envName + "_API_KEY"
+				if p.BaseURL == "" {
+					return nil, fmt.Errorf("provider %q needs %s_BASE_URL", name, envName)
+				}
+			}
+			providers[name] = p
+		}
+		chain = append(chain, llmCandidate{Provider: p, Model: model})
+	}
+	return chain, nil
+}
+
+func mustParseLLMChain(spec string) []llmCandidate {
+	chain, err := parseLLMChain(spec)
+	if err != nil {
+		panic(err)
+	}
+	return chain
+}
+
+// llm is the active configuration, replaced at startup.
+var llm = llmConfig{Chain: mustParseLLMChain(defaultLLMProviders), Timeout: defaultLLMTimeout}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider serves chat completions with the given status, counting the
+// calls it receives.
+func fakeProvider(t *testing.T, status int, model string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":   model,
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "summary by " + model}}},
+			"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 2},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func useLLMChain(t *testing.T, spec string, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	orig := llm
+	t.Cleanup(func() { llm = orig })
+	llm = llmConfig{Chain: mustParseLLMChain(spec), Timeout: time.Second}
+}
+
+func TestGenerateSummaryFailover(t *testing.T) {
+	down, downCalls := fakeProvider(t, http.StatusServiceUnavailable, "")
+	up, _ := fakeProvider(t, http.StatusOK, "backup-model")
+	useLLMChain(t, "primary:big-model,secondary:backup-model", map[string]string{
+		"LLM_PROVIDER_PRIMARY_BASE_URL":   down.URL,
+		"LLM_PROVIDER_SECONDARY_BASE_URL": up.URL,
+	})
+
+	for range llmBreakerThreshold + 1 {
+		summary, err := generateSummary(context.Background(), renderedPrompt{System: "Summarize.", User: "article"})
+		if err != nil {
+			t.Fatalf("expected the fallback to answer, got %v", err)
+		}
+		if summary.Model != "backup-model" || summary.Provider != "secondary" {
+			t.Errorf("expected the model that answered to be reported, got %+v", summary)
+		}
+	}
+
+	if got := downCalls.Load(); got != llmBreakerThreshold {
+		t.Errorf("expected the breaker to stop calls after %d failures, got %d calls", llmBreakerThreshold, got)
+	}
+	if state := llm.Chain[0].Provider.breaker.State(); state != breakerOpen {
+		t.Errorf("expected the primary's breaker to be open, got %s", state)
+	}
+}
+
+func TestGenerateSummaryStopsOnClientError(t *testing.T) {
+	bad, _ := fakeProvider(t, http.StatusBadRequest, "")
+	up, upCalls := fakeProvider(t, http.StatusOK, "backup-model")
+	useLLMChain(t, "primary:big-model,secondary:backup-model", map[string]string{
+		"LLM_PROVIDER_PRIMARY_BASE_URL":   bad.URL,
+		"LLM_PROVIDER_SECONDARY_BASE_URL": up.URL,
+	})
+
+	if _, err := generateSummary(context.Background(), renderedPrompt{System: "Summarize.", User: "article"}); err == nil {
+		t.Fatal("expected a rejected request to fail")
+	}
+	if upCalls.Load() != 0 {
+		t.Error("expected no failover for a 400, every provider would reject the same request")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("expected the breaker to stay closed below the threshold")
+	}
+	b.Failure()
+	if b.Allow() || !b.Open() {
+		t.Fatal("expected the breaker to open at the threshold")
+	}
+
+	now = now.Add(time.Minute)
+	// Checking does not use up the trial call.
+	if b.Open() || b.State() != breakerOpen {
+		t.Fatal("expected the breaker to stop refusing calls after the cooldown")
+	}
+	if !b.Allow() || b.Allow() {
+		t.Fatal("expected exactly one trial call after the cooldown")
+	}
+	b.Failure()
+	if b.State() != breakerOpen {
+		t.Fatalf("expected a failed trial to reopen the breaker, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if b.State() != breakerClosed || !b.Allow() {
+		t.Errorf("expected a successful trial to close the breaker, got %s", b.State())
+	}
+}
+
+func TestParseLLMChain(t *testing.T) {
+	t.Setenv("LLM_PROVIDER_LOCAL_BASE_URL", "http://localhost:11434/v1/")
+
+	chain, err := parseLLMChain("openrouter:openai/gpt-4o:free, openrouter:@preset/hn30-summary, local:llama3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 || chain[0].Model != "openai/gpt-4o:free" || chain[2].Provider.BaseURL != "http://localhost:11434/v1" {
+		t.Errorf("unexpected chain %+v", chain)
+	}
+	if chain[0].Provider != chain[1].Provider {
+		t.Error("expected entries for one provider to share its circuit breaker")
+	}
+
+	if _, err := parseLLMChain("unknown:model"); err == nil {
+		t.Error("expected a provider without a base URL to be rejected")
+	}
+}
+
+func TestLLMPrices(t *testing.T) {
+	up, _ := fakeProvider(t, http.StatusOK, "llama3.1")
+	t.Setenv("LLM_PROVIDERS", "openrouter:@preset/hn30-summary,local:llama3.1")
+	t.Setenv("LLM_PROVIDER_LOCAL_BASE_URL", up.URL)
+	t.Setenv("LLM_PRICES", "local:llama3.1=1000/5000")
+
+	cfg, err := llmConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Chain[0].Price != nil || cfg.Chain[1].Price == nil {
+		t.Fatalf("expected only the local model to be priced, got %+v", cfg.Chain)
+	}
+
+	orig := llm
+	t.Cleanup(func() { llm = orig })
+	llm = llmConfig{Chain: cfg.Chain[1:], Timeout: time.Second}
+	summary, err := generateSummary(context.Background(), renderedPrompt{System: "Summarize.", User: "article"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 prompt tokens at $1000/M and 2 completion tokens at $5000/M.
+	if want := 0.02; summary.Usage.Cost < want-1e-9 || summary.Usage.Cost > want+1e-9 {
+		t.Errorf("expected an estimated cost of %v, got %v", want, summary.Usage.Cost)
+	}
+
+	for _, spec := range []string{"local:llama3.1=1", "local:llama3.1=a/b", "openai:gpt-4o=1/2"} {
+		t.Setenv("LLM_PRICES", spec)
+		if _, err := llmConfigFromEnv(); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package logging provides the process-wide structured logger. Code obtains
+// a logger with FromContext, which carries the job_id or request_id and the
+// trace and span IDs stored in the context so every line of one refresh or
+// request can be correlated across the HN client, scraper, summarizer and
+// database, and with its trace.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config is read from the environment by ConfigFromEnv:
+//
+//	LOG_LEVEL              debug, info, warn or error (default info)
+//	LOG_FORMAT             json or text (default json)
+//	LOG_DEBUG_SAMPLE_RATE  log 1 in N debug records per message (default 1, all)
+type Config struct {
+	Level           slog.Level
+	Format          string
+	DebugSampleRate int
+}
+
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Level: slog.LevelInfo, Format: "json", DebugSampleRate: 1}
+
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := cfg.Level.UnmarshalText([]byte(v)); err != nil {
+			return cfg, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", v)
+		}
+	}
+
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		v = strings.ToLower(v)
+		if v != "json" && v != "text" {
+			return cfg, fmt.Errorf("LOG_FORMAT must be json or text, got %q", v)
+		}
+		cfg.Format = v
+	}
+
+	if v := os.Getenv("LOG_DEBUG_SAMPLE_RATE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("LOG_DEBUG_SAMPLE_RATE must be a positive integer, got %q", v)
+		}
+		cfg.DebugSampleRate = n
+	}
+
+	return cfg, nil
+}
+
+var base atomic.Pointer[slog.Logger]
+
+func init() {
+	base.Store(New(os.Stdout, Config{Level: slog.LevelInfo, Format: "json", DebugSampleRate: 1}))
+}
+
+// New builds a logger writing to w according to cfg.
+func New(w io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+
+	var h slog.Handler
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	if cfg.DebugSampleRate > 1 {
+		h = newSamplingHandler(h, cfg.DebugSampleRate)
+	}
+	return slog.New(h)
+}
+
+// Init replaces the process logger and routes the standard library's log
+// package and slog's default logger through it.
+func Init(cfg Config) {
+	logger := New(os.Stdout, cfg)
+	base.Store(logger)
+	slog.SetDefault(logger)
+}
+
+// L returns the process logger, for code that has no context.
+func L() *slog.Logger {
+	return base.Load()
+}
+
+type ctxKey int
+
+const (
+	jobIDKey ctxKey = iota
+	requestIDKey
+)
+
+// WithJobID returns a context carrying the ID of a background job such as a
+// cache refresh.
+func WithJobID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, jobIDKey, id)
+}
+
+// JobID returns the job ID stored in ctx, or "".
+func JobID(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDKey).(string)
+	return id
+}
+
+// WithRequestID returns a context carrying the ID of an HTTP request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the process logger annotated with the job_id and
+// request_id stored in ctx.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := L()
+	if ctx == nil {
+		return logger
+	}
+	if id := JobID(ctx); id != "" {
+		logger = logger.With("job_id", id)
+	}
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+	return logger
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFromContextAddsIDs(t *testing.T) {
+	var buf bytes.Buffer
+	orig := L()
+	base.Store(New(&buf, Config{Level: slog.LevelInfo, Format: "json", DebugSampleRate: 1}))
+	t.Cleanup(func() { base.Store(orig) })
+
+	ctx := WithRequestID(WithJobID(context.Background(), "job-1"), "req-1")
+	FromContext(ctx).Info("hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decoding log line: %v", err)
+	}
+	if line["job_id"] != "job-1" || line["request_id"] != "req-1" {
+		t.Errorf("expected job and request IDs in the log line, got %v", line)
+	}
+}
+
+func TestFromContextAddsTraceIDs(t *testing.T) {
+	var buf bytes.Buffer
+	orig := L()
+	base.Store(New(&buf, Config{Level: slog.LevelInfo, Format: "json", DebugSampleRate: 1}))
+	t.Cleanup(func() { base.Store(orig) })
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	FromContext(trace.ContextWithSpanContext(context.Background(), sc)).Info("hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decoding log line: %v", err)
+	}
+	if line["trace_id"] != sc.TraceID().String() || line["span_id"] != sc.SpanID().String() {
+		t.Errorf("expected trace and span IDs in the log line, got %v", line)
+	}
+}
+
+func TestDebugSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Config{Level: slog.LevelDebug, Format: "text", DebugSampleRate: 3}).With("event_type", "test")
+
+	for range 6 {
+		logger.Debug("story fetched")
+		logger.Info("refresh step")
+	}
+	logger.Debug("other event")
+
+	out := buf.String()
+	if n := strings.Count(out, "story fetched"); n != 2 {
+		t.Errorf("expected 2 of 6 sampled debug lines, got %d", n)
+	}
+	if n := strings.Count(out, "refresh step"); n != 6 {
+		t.Errorf("expected every info line, got %d", n)
+	}
+	if !strings.Contains(out, "other event") {
+		t.Error("expected the first occurrence of each debug message to be logged")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "TEXT")
+	t.Setenv("LOG_DEBUG_SAMPLE_RATE", "10")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Level != slog.LevelDebug || cfg.Format != "text" || cfg.DebugSampleRate != 10 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("LOG_LEVEL", "loud")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected an invalid level to be rejected")
+	}
+}
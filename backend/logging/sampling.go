@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// samplingHandler passes 1 in rate debug records per message and every
+// record at higher levels. Per-story debug events repeat with the same
+// message on every refresh, so the message is the sampling key.
+type samplingHandler struct {
+	next     slog.Handler
+	rate     uint64
+	counters *sync.Map // message -> *atomic.Uint64
+}
+
+func newSamplingHandler(next slog.Handler, rate int) *samplingHandler {
+	return &samplingHandler{next: next, rate: uint64(rate), counters: &sync.Map{}}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= slog.LevelDebug {
+		c, _ := h.counters.LoadOrStore(r.Message, &atomic.Uint64{})
+		if (c.(*atomic.Uint64).Add(1)-1)%h.rate != 0 {
+			return nil
+		}
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), rate: h.rate, counters: h.counters}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), rate: h.rate, counters: h.counters}
+}
@@ -2,14 +2,13 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hn30/backend/db"
+	"hn30/backend/logging"
 	"hn30/backend/types"
-	"hn30/backend/utils"
 	"log"
-	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,6 +17,9 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/OneSignal/onesignal-go-api/v5"
 )
@@ -29,21 +31,37 @@ type EnrichedStory struct {
 	Summary       string `json:"summary,omitempty"`
 	ArticleText   string `json:"-"` // Don't send full text to client
 	SummaryModel  string `json:"model,omitempty"`
+	// SummaryPromptVersion is the prompt template version Summary was
+	// generated with.
+	SummaryPromptVersion string `json:"-"`
+	// Article stats, known once the article text has been read.
+	WordCount          int    `json:"wordCount,omitempty"`
+	ReadingTimeMinutes int    `json:"readingTimeMinutes,omitempty"`
+	Language           string `json:"language,omitempty"`
+	// Tags are topics from the fixed list in topics.go.
+	Tags []string `json:"tags,omitempty"`
 }
 
-const (
-	hnBaseURL       = "https://hacker-news.firebaseio.com/v0"
-	customUserAgent = "yamanlabs-hn/2.0 (+https://hn30.yamanlabs.com)"
+const customUserAgent = "yamanlabs-hn/2.0 (+https://hn30.yamanlabs.com)"
+
+// Overridable in tests.
+var (
+	hnBaseURL        = "https://hacker-news.firebaseio.com/v0"
+	scrapeDelay      = 500 * time.Millisecond
+	pushNotification = sendNotification
 )
 
+// refreshInterval is how often the top list is refreshed.
+const refreshInterval = 5 * time.Minute
+
 var storyCache *Cache
-var dbConn *sql.DB
+var store db.Store
 
 var oneSignalConfig = onesignal.NewConfiguration()
 var oneSignalApiClient = onesignal.NewAPIClient(oneSignalConfig)
 
-func getTopStoryIDs() ([]int, error) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+func getTopStoryIDs(ctx context.Context) ([]int, error) {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "fetch_top_story_ids",
 		"url", fmt.Sprintf("%s/topstories.json", hnBaseURL),
 	)
@@ -53,7 +71,7 @@ func getTopStoryIDs() ([]int, error) {
 		"event", "fetch_started",
 	)
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/topstories.json", hnBaseURL), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/topstories.json", hnBaseURL), nil)
 	if err != nil {
 		logger.Error("request creation failed",
 			"event", "request_creation_failed",
@@ -75,7 +93,7 @@ func getTopStoryIDs() ([]int, error) {
 	}
 	defer resp.Body.Close()
 
-	logger.Info("response received",
+	logger.Debug("response received",
 		"event", "response_received",
 		"status_code", resp.StatusCode,
 		"content_length", resp.ContentLength,
@@ -101,19 +119,33 @@ func getTopStoryIDs() ([]int, error) {
 	return ids, nil
 }
 
-func getStoryDetails(id int) (*types.Story, error) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+// hnItem is a story from the Hacker News API. Text is the HTML body of a
+// self post, empty for links. Dead and deleted items are hidden on the site.
+type hnItem struct {
+	types.Story
+	Text    string `json:"text"`
+	Dead    bool   `json:"dead"`
+	Deleted bool   `json:"deleted"`
+}
+
+func getStoryDetails(ctx context.Context, id int) (*hnItem, error) {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "fetch_story_details",
 		"story_id", id,
 		"url", fmt.Sprintf("%s/item/%d.json", hnBaseURL, id),
 	)
 	start := time.Now()
 
-	logger.Info("fetching story details",
+	logger.Debug("fetching story details",
 		"event", "fetch_started",
 	)
 
-	resp, err := http.Get(fmt.Sprintf("%s/item/%d.json", hnBaseURL, id))
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/item/%d.json", hnBaseURL, id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		logger.Error("http request failed",
 			"event", "http_request_failed",
@@ -124,13 +156,13 @@ func getStoryDetails(id int) (*types.Story, error) {
 	}
 	defer resp.Body.Close()
 
-	logger.Info("response received",
+	logger.Debug("response received",
 		"event", "response_received",
 		"status_code", resp.StatusCode,
 		"content_length", resp.ContentLength,
 	)
 
-	var story types.Story
+	var story hnItem
 	if err := json.NewDecoder(resp.Body).Decode(&story); err != nil {
 		logger.Error("json decode failed",
 			"event", "json_decode_failed",
@@ -140,7 +172,7 @@ func getStoryDetails(id int) (*types.Story, error) {
 		return nil, err
 	}
 
-	logger.Info("story details fetched successfully",
+	logger.Debug("story details fetched successfully",
 		"event", "fetch_completed",
 		"story_title", story.Title,
 		"story_url", story.URL,
@@ -156,12 +188,11 @@ func getStoryDetails(id int) (*types.Story, error) {
 
 func refreshCache() {
 
-	ctx := context.Background()
+	ctx := logging.WithJobID(context.Background(), uuid.NewString())
+	ctx, span := tracer.Start(ctx, "refresh_cache")
+	defer span.End()
 
-	jobID := uuid.NewString()
-	ctx = context.WithValue(ctx, "job_id", jobID)
-
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("event_type", "cache_refresh", "job_id", jobID)
+	logger := logging.FromContext(ctx).With("event_type", "cache_refresh")
 	cacheStart := time.Now()
 
 	logger.Info(
@@ -169,8 +200,13 @@ func refreshCache() {
 		"event", "cache_refresh_started",
 	)
 
-	ids, err := getTopStoryIDs()
+	idsCtx, idsSpan := tracer.Start(ctx, "hn.get_top_story_ids")
+	ids, err := getTopStoryIDs(idsCtx)
+	endSpan(idsSpan, err)
 	if err != nil {
+		span.SetStatus(codes.Error, "fetching top story ids failed")
+		refreshStageErrors.WithLabelValues("get_top_story_ids").Inc()
+		refreshesTotal.WithLabelValues("failure").Inc()
 		logger.Error("cache_refresh_failed",
 			"event", "cache_refresh_failed",
 			"stage", "get_top_story_ids",
@@ -192,11 +228,23 @@ func refreshCache() {
 		"used_ids", len(topIDs),
 	)
 
-	for _, id := range topIDs {
+	span.SetAttributes(attribute.Int("refresh.stories", len(topIDs)))
+
+	for i, id := range topIDs {
 		storyStart := time.Now()
+		rank := i + 1
+
+		storyCtx, storySpan := tracer.Start(ctx, "process_story", trace.WithAttributes(
+			attribute.Int("story.id", id),
+			attribute.Int("story.rank", rank),
+		))
 
-		story, err := getStoryDetails(id)
+		detailsCtx, detailsSpan := tracer.Start(storyCtx, "hn.get_story_details")
+		story, err := getStoryDetails(detailsCtx, id)
+		endSpan(detailsSpan, err)
 		if err != nil {
+			endSpan(storySpan, err)
+			refreshStageErrors.WithLabelValues("get_story_details").Inc()
 			logger.Warn("story_processing_failed",
 				"event", "story_processing_failed",
 				"story_id", id,
@@ -210,101 +258,157 @@ func refreshCache() {
 		if story.URL == "" {
 			urlWasMissing = true
 			story.URL = fmt.Sprintf("https://news.ycombinator.com/item?id=%d", id)
-			// Fall through and attempt to fetch OG data for the HN item page
 		}
 
-		if existingStory, found := storyCache.Get(id); found && existingStory.URL == story.URL {
+		existingStory, found := storyCache.Get(id)
+		cached := found && existingStory.URL == story.URL
+
+		var enrichedStory EnrichedStory
+		if cached {
 			existingStory.Score = story.Score
 			existingStory.Descendants = story.Descendants
+			enrichedStory = existingStory
+		} else {
+			var selfPost document
+			if urlWasMissing {
+				selfPost = selfPostDocument(story)
+			}
 
-			utils.LogInfo("Story %d already in cache and URL unchanged, reusing OG data and updating stats", id)
+			var ogImage, ogDescription string
+			if selfPost.Text != "" {
+				// The item page has no og: tags, and the text is already
+				// here: it describes the post and is kept for stats and
+				// summaries instead of being fetched again.
+				ogDescription = selfPost.description()
+			} else {
+				ogCtx, ogSpan := tracer.Start(storyCtx, "scrape.og_data", trace.WithAttributes(
+					attribute.String("url.full", story.URL),
+				))
+				ogImage, ogDescription, err = getOGData(ogCtx, story.URL)
+				endSpan(ogSpan, err)
+				if err != nil {
+					refreshStageErrors.WithLabelValues("og_fetch").Inc()
+					logger.Warn("og_fetch_failed",
+						"event", "og_fetch_failed",
+						"story_id", id,
+						"url", story.URL,
+						"error", err,
+					)
+				}
+			}
 
-			if err := db.UpsertStory(dbConn, *story); err != nil {
-				logger.Error("story_upsert_failed",
-					"event", "story_upsert_failed",
-					"story_id", id,
-					"cached", true,
-					"error", err,
-				)
+			enrichedStory = EnrichedStory{
+				Story:         story.Story,
+				OGImage:       ogImage,
+				OGDescription: ogDescription,
+				ArticleText:   selfPost.Text,
 			}
 
-			if db.ShouldNotify(dbConn, *story) {
-				go sendNotification(existingStory)
-				db.MarkNotified(dbConn, story.ID)
+			if articleStatsOnRefresh {
+				statsCtx, statsSpan := tracer.Start(storyCtx, "scrape.article_stats")
+				err := refreshArticleStats(statsCtx, &enrichedStory)
+				endSpan(statsSpan, err)
+				if err != nil {
+					refreshStageErrors.WithLabelValues("article_stats").Inc()
+					logger.Warn("article_stats_failed",
+						"event", "article_stats_failed",
+						"story_id", id,
+						"url", story.URL,
+						"error", err,
+					)
+				}
+			}
 
-				logger.Info("notification_sent",
-					"event", "notification_sent",
+			topicsCtx, topicsSpan := tracer.Start(storyCtx, "classify.topics")
+			err = classifyStory(topicsCtx, &enrichedStory)
+			endSpan(topicsSpan, err)
+			if err != nil {
+				refreshStageErrors.WithLabelValues("classify_topics").Inc()
+				logger.Warn("topic_classification_failed",
+					"event", "topic_classification_failed",
 					"story_id", id,
-					"cached", true,
+					"error", err,
 				)
 			}
 
-			storyCache.Set(id, existingStory)
-
-			logger.Info("story_skipped_cached",
-				"event", "story_skipped_cached",
-				"story_id", id,
-				"url", story.URL,
-				"url_was_missing", urlWasMissing,
-				"score", story.Score,
-				"descendants", story.Descendants,
-				"duration_ms", time.Since(storyStart).Milliseconds(),
-			)
-
-			continue
+			if embeddings != nil {
+				embedCtx, embedSpan := tracer.Start(storyCtx, "embed.story")
+				_, err := embedStory(embedCtx, enrichedStory, false)
+				endSpan(embedSpan, err)
+				if err != nil {
+					refreshStageErrors.WithLabelValues("embed").Inc()
+					logger.Warn("story_embedding_failed",
+						"event", "story_embedding_failed",
+						"story_id", id,
+						"error", err,
+					)
+				}
+			}
 		}
 
-		ogImage, ogDescription, err := getOGData(story.URL)
+		dbCtx, dbSpan := tracer.Start(storyCtx, "db.persist_story")
+		notified, err := persistStory(dbCtx, enrichedStory, rank, cacheStart)
+		endSpan(dbSpan, err)
 		if err != nil {
-			logger.Warn("og_fetch_failed",
-				"event", "og_fetch_failed",
+			refreshStageErrors.WithLabelValues("persist_story").Inc()
+			logger.Error("story_persist_failed",
+				"event", "story_persist_failed",
 				"story_id", id,
-				"url", story.URL,
+				"cached", cached,
 				"error", err,
 			)
 		}
-
-		enrichedStory := EnrichedStory{
-			Story:         *story,
-			OGImage:       ogImage,
-			OGDescription: ogDescription,
+		if notified {
+			go func(s EnrichedStory) {
+				notifyCtx, notifySpan := tracer.Start(storyCtx, "notification.send")
+				pushNotification(notifyCtx, s)
+				notifySpan.End()
+			}(enrichedStory)
 		}
 
-		if err := db.UpsertStory(dbConn, *story); err != nil {
-			logger.Error("story_upsert_failed",
-				"event", "story_upsert_failed",
+		storyCache.Set(id, enrichedStory)
+		storySpan.SetAttributes(
+			attribute.Bool("story.cached", cached),
+			attribute.Bool("story.notified", notified),
+		)
+		storySpan.End()
+
+		if cached {
+			logger.Info("story_skipped_cached",
+				"event", "story_skipped_cached",
 				"story_id", id,
-				"cached", false,
-				"error", err,
+				"rank", rank,
+				"url", story.URL,
+				"url_was_missing", urlWasMissing,
+				"score", story.Score,
+				"descendants", story.Descendants,
+				"notified", notified,
+				"duration_ms", time.Since(storyStart).Milliseconds(),
 			)
-		}
 
-		notified := false
-		if db.ShouldNotify(dbConn, *story) {
-			go sendNotification(enrichedStory)
-			db.MarkNotified(dbConn, story.ID)
-			notified = true
+			continue
 		}
 
-		storyCache.Set(id, enrichedStory)
-
 		logger.Info("story_processed",
 			"event", "story_processed",
 			"story_id", id,
+			"rank", rank,
 			"url", story.URL,
 			"url_was_missing", urlWasMissing,
 			"score", story.Score,
 			"descendants", story.Descendants,
-			"og_image_present", ogImage != "",
-			"og_description_present", ogDescription != "",
+			"og_image_present", enrichedStory.OGImage != "",
+			"og_description_present", enrichedStory.OGDescription != "",
 			"notified", notified,
 			"duration_ms", time.Since(storyStart).Milliseconds(),
 		)
 
-		time.Sleep(500 * time.Millisecond) // Rate limit scraping
+		time.Sleep(scrapeDelay) // Rate limit scraping
 	}
 
 	storyCache.SetLastUpdated(time.Now())
+	refreshesTotal.WithLabelValues("success").Inc()
+	refreshDuration.Observe(time.Since(cacheStart).Seconds())
 
 	logger.Info("cache_refresh_completed",
 		"event", "cache_refresh_completed",
@@ -313,16 +417,177 @@ func refreshCache() {
 	)
 }
 
-func sendNotification(story EnrichedStory) {
+// persistStory records a processed story, its top-list snapshot and its
+// metadata in one transaction, and reports whether a push notification is
+// due. The story is marked as notified in the same transaction, so a story
+// is never recorded as notified unless everything else was saved too.
+func persistStory(ctx context.Context, story EnrichedStory, rank int, takenAt time.Time) (bool, error) {
+	notify := false
+
+	err := store.WithTx(ctx, func(tx db.Store) error {
+		if err := tx.UpsertStory(ctx, story.Story); err != nil {
+			return fmt.Errorf("upsert_story: %w", err)
+		}
+		if err := tx.RecordSnapshot(ctx, story.Story, rank, takenAt); err != nil {
+			return fmt.Errorf("record_snapshot: %w", err)
+		}
+		if err := tx.UpsertStoryMetadata(ctx, story.Story, story.OGImage, story.OGDescription); err != nil {
+			return fmt.Errorf("upsert_story_metadata: %w", err)
+		}
+
+		eligible, err := tx.ShouldNotify(ctx, story.Story)
+		if err != nil {
+			return fmt.Errorf("should_notify: %w", err)
+		}
+		if !eligible {
+			return nil
+		}
+		if err := tx.MarkNotified(ctx, story.ID); err != nil {
+			return fmt.Errorf("mark_notified: %w", err)
+		}
+		notify = true
+		return nil
+	})
+
+	return notify && err == nil, err
+}
+
+var errStoryNotFound = errors.New("story not found")
+
+const (
+	liveStoryTTL        = 5 * time.Minute
+	liveStoryMaxEntries = 1000
+)
+
+// liveStories holds what findStory fetched from Hacker News.
+var liveStories = NewLiveCache(liveStoryTTL, liveStoryMaxEntries)
+
+// storedToEnriched is a story as the API returns it, from what the database
+// knows about it. Every endpoint serving stored stories goes through it so
+// they all carry the same fields.
+func storedToEnriched(s db.StoredStory) EnrichedStory {
+	story := EnrichedStory{
+		Story:         s.Story,
+		OGImage:       s.OGImage,
+		OGDescription: s.OGDescription,
+		Tags:          s.Tags,
+	}
+	story.applyArticleStats(s.Stats)
+	return story
+}
+
+// findStory resolves a single story, preferring the in-memory cache, then
+// the stories we have persisted, and finally a live fetch from Hacker News
+// so links to stories that dropped off the front page keep working. Live
+// results are kept for liveStoryTTL. The returned source is one of "cache",
+// "database" or "hacker_news".
+func findStory(ctx context.Context, id int) (EnrichedStory, string, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "story_lookup",
+		"story_id", id,
+	)
+	start := time.Now()
+
+	if story, found := storyCache.Get(id); found {
+		logger.Info("story found in cache",
+			"event", "story_lookup_completed",
+			"source", "cache",
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return story, "cache", nil
+	}
+
+	stored, err := store.GetStory(ctx, id)
+	if err == nil {
+		logger.Info("story found in database",
+			"event", "story_lookup_completed",
+			"source", "database",
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return storedToEnriched(stored), "database", nil
+	}
+	if err != db.ErrNotFound {
+		// Not fatal: Hacker News is still the source of truth.
+		logger.Warn("database lookup failed",
+			"event", "story_lookup_db_failed",
+			"error", err,
+		)
+	}
+
+	if story, found := liveStories.Get(id); found {
+		logger.Info("live story found in cache",
+			"event", "story_lookup_completed",
+			"source", "hacker_news",
+			"cached", true,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return story, "hacker_news", nil
+	}
+
+	story, err := getStoryDetails(ctx, id)
+	if err != nil {
+		logger.Error("live story fetch failed",
+			"event", "story_lookup_failed",
+			"stage", "get_story_details",
+			"error", err,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return EnrichedStory{}, "", err
+	}
+
+	// Unknown IDs come back as JSON null and comments have no title. Dead
+	// and deleted stories are hidden on the site, so they are here too.
+	if story.ID == 0 || story.Title == "" || story.Dead || story.Deleted {
+		logger.Info("item is not a story",
+			"event", "story_lookup_completed",
+			"source", "hacker_news",
+			"found", false,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return EnrichedStory{}, "", errStoryNotFound
+	}
+
+	var selfPost document
+	if story.URL == "" {
+		story.URL = fmt.Sprintf("https://news.ycombinator.com/item?id=%d", id)
+		selfPost = selfPostDocument(story)
+	}
+
+	// Self posts are described by their text, as in refreshCache.
+	var ogImage, ogDescription string
+	if selfPost.Text != "" {
+		ogDescription = selfPost.description()
+	} else {
+		ogImage, ogDescription, err = getOGData(ctx, story.URL)
+		if err != nil {
+			logger.Warn("og_fetch_failed",
+				"event", "og_fetch_failed",
+				"url", story.URL,
+				"error", err,
+			)
+		}
+	}
 
-	ctx := context.Background()
+	logger.Info("story fetched from hacker news",
+		"event", "story_lookup_completed",
+		"source", "hacker_news",
+		"found", true,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
 
-	jobID := uuid.NewString()
-	ctx = context.WithValue(ctx, "job_id", jobID)
+	enriched := EnrichedStory{
+		Story:         story.Story,
+		OGImage:       ogImage,
+		OGDescription: ogDescription,
+		ArticleText:   selfPost.Text,
+	}
+	liveStories.Set(id, enriched)
+	return enriched, "hacker_news", nil
+}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+func sendNotification(ctx context.Context, story EnrichedStory) {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "push_notification",
-		"job_id", jobID,
 		"story_id", story.ID,
 		"story_title", story.Title,
 		"story_url", story.URL,
@@ -334,6 +599,7 @@ func sendNotification(story EnrichedStory) {
 	restApiKey := os.Getenv("ONESIGNAL_KEY")
 
 	if appId == "" || restApiKey == "" {
+		notificationsTotal.WithLabelValues("skipped").Inc()
 		logger.Error("onesignal credentials missing",
 			"event", "credentials_missing",
 			"app_id_present", appId != "",
@@ -348,7 +614,7 @@ func sendNotification(story EnrichedStory) {
 	)
 
 	osAuthCtx := context.WithValue(
-		context.Background(),
+		ctx,
 		onesignal.RestApiKey,
 		restApiKey)
 
@@ -377,6 +643,7 @@ func sendNotification(story EnrichedStory) {
 	resp, httpResp, err := oneSignalApiClient.DefaultApi.CreateNotification(osAuthCtx).Notification(notification).Execute()
 
 	if err != nil {
+		notificationsTotal.WithLabelValues("failed").Inc()
 		logger.Error("notification send failed",
 			"event", "notification_send_failed",
 			"error", err,
@@ -391,6 +658,7 @@ func sendNotification(story EnrichedStory) {
 		return
 	}
 
+	notificationsTotal.WithLabelValues("sent").Inc()
 	logger.Info("notification sent successfully",
 		"event", "notification_sent",
 		"notification_id", resp.GetId(),
@@ -401,13 +669,13 @@ func sendNotification(story EnrichedStory) {
 }
 
 func startCacheRefresher() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+	logger := logging.L().With(
 		"event_type", "cache_refresher",
 	)
 
 	logger.Info("initializing cache refresher",
 		"event", "cache_refresher_initialized",
-		"refresh_interval", "5m",
+		"refresh_interval", refreshInterval.String(),
 	)
 
 	storyCache = NewCache()
@@ -417,10 +685,10 @@ func startCacheRefresher() {
 		)
 		refreshCache()
 
-		ticker := time.NewTicker(5 * time.Minute)
+		ticker := time.NewTicker(refreshInterval)
 		logger.Info("cache refresher running",
 			"event", "refresher_running",
-			"interval", "5m",
+			"interval", refreshInterval.String(),
 		)
 
 		for range ticker.C {
@@ -432,10 +700,34 @@ func startCacheRefresher() {
 	}()
 }
 
+// databaseDSNFromEnv returns DATABASE_URL if set (a postgres:// URL selects
+// PostgreSQL), otherwise the SQLite path from SQLITE_PATH.
+func databaseDSNFromEnv() string {
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn
+	}
+
+	sqlitePath := os.Getenv("SQLITE_PATH")
+	if sqlitePath == "" {
+		sqlitePath = "./data/hn30.db"
+	}
+	return sqlitePath
+}
+
 func main() {
 	log.SetFlags(0)
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+	logCfg, err := logging.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.Init(logCfg)
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	logger := logging.L().With(
 		"event_type", "server_lifecycle",
 		"version", "1.0",
 	)
@@ -447,22 +739,137 @@ func main() {
 		"timestamp", startTime,
 	)
 
-	// Database initialization
-	sqlitePath := os.Getenv("SQLITE_PATH")
-	if sqlitePath == "" {
-		sqlitePath = "./data/hn30.db"
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		logger.Error("tracing setup failed",
+			"event", "tracing_setup_failed",
+			"error", err,
+		)
+		log.Fatal(err)
 	}
+
+	// Database initialization
+	dialect := db.DialectFor(databaseDSNFromEnv())
 	logger.Info("initializing database",
 		"event", "db_init_started",
-		"db_path", sqlitePath,
+		"dialect", dialect,
 	)
-	dbConn = db.Open(sqlitePath)
+	if err := restoreFromEnv(databaseDSNFromEnv()); err != nil {
+		logger.Error("database restore failed",
+			"event", "db_restore_failed",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	store = db.OpenStore(databaseDSNFromEnv())
 	logger.Info("database initialized",
 		"event", "db_init_completed",
-		"db_path", sqlitePath,
+		"dialect", dialect,
+	)
+
+	// Article stats
+	articleStatsOnRefresh, err = articleStatsOnRefreshFromEnv()
+	if err != nil {
+		logger.Error("invalid article stats configuration",
+			"event", "article_stats_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	logger.Info("article stats configured",
+		"event", "article_stats_configured",
+		"on_refresh", articleStatsOnRefresh,
+	)
+
+	// LLM providers
+	llm, err = llmConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid llm provider configuration",
+			"event", "llm_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	chain := make([]string, 0, len(llm.Chain))
+	for _, c := range llm.Chain {
+		chain = append(chain, c.Provider.Name+":"+c.Model)
+	}
+	logger.Info("llm providers configured",
+		"event", "llm_configured",
+		"chain", chain,
+		"timeout", llm.Timeout.String(),
+	)
+
+	// Prompt template
+	summaryPrompt, err = loadPromptTemplate(os.Getenv("PROMPT_TEMPLATE"))
+	if err != nil {
+		logger.Error("invalid prompt template",
+			"event", "prompt_template_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	logger.Info("prompt template loaded",
+		"event", "prompt_template_loaded",
+		"prompt_version", summaryPrompt.Version,
+	)
+
+	// LLM budget
+	llmBudget, err = budgetConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid llm budget configuration",
+			"event", "budget_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	if err := checkBudgetPricing(llmBudget, llm.Chain); err != nil {
+		logger.Error("invalid llm budget configuration",
+			"event", "budget_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	logger.Info("llm budget configured",
+		"event", "budget_configured",
+		"daily_usd", llmBudget.DailyUSD,
+		"monthly_usd", llmBudget.MonthlyUSD,
+	)
+
+	// Topic classification
+	topicClassifier, err = topicClassifierFromEnv()
+	if err != nil {
+		logger.Error("invalid topic classifier configuration",
+			"event", "topic_classifier_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	logger.Info("topic classifier configured",
+		"event", "topic_classifier_configured",
+		"classifier", topicClassifier,
+	)
+
+	// Embeddings for related stories
+	embeddings, err = embeddingsFromEnv()
+	if err != nil {
+		logger.Error("invalid embeddings configuration",
+			"event", "embeddings_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	embeddingModel := "off"
+	if embeddings != nil {
+		embeddingModel = embeddings.Model()
+	}
+	logger.Info("embeddings configured",
+		"event", "embeddings_configured",
+		"model", embeddingModel,
 	)
 
-	// Cache initialization
+	// Cache initialization. The first refresh starts right away, so
+	// everything it reads must be configured above this point.
 	logger.Info("starting cache refresher",
 		"event", "cache_init_started",
 	)
@@ -471,15 +878,72 @@ func main() {
 		"event", "cache_init_completed",
 	)
 
-	// HTTP server setup
-	server := &http.Server{Addr: ":8080"}
+	// Backups
+	backupCfg, err := backupConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid backup configuration",
+			"event", "backup_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	startBackupScheduler(backupCfg)
+
+	// Retention
+	retentionCfg, err := retentionConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid retention configuration",
+			"event", "retention_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	startRetentionJob(retentionCfg)
+
+	// Client IP detection
+	trustedProxies, err = trustedProxiesFromEnv()
+	if err != nil {
+		logger.Error("invalid trusted proxy configuration",
+			"event", "trusted_proxies_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	logger.Info("trusted proxies configured",
+		"event", "trusted_proxies_configured",
+		"trusted_proxies", len(trustedProxies),
+	)
 
-	http.Handle("/api/top", LoggingMiddleware(http.HandlerFunc(topStoriesHandler)))
-	http.Handle("/api/summarize", LoggingMiddleware(rateLimitMiddleware(http.HandlerFunc(summarizeHandler))))
+	// Rate limiting
+	rateLimitCfg, err := rateLimitConfigFromEnv()
+	if err != nil {
+		logger.Error("invalid rate limit configuration",
+			"event", "rate_limit_config_invalid",
+			"error", err,
+		)
+		log.Fatal(err)
+	}
+	setupRateLimiting(rateLimitCfg)
+
+	// HTTP server setup
+	server := &http.Server{Addr: ":8080", Handler: requestIDMiddleware(http.DefaultServeMux)}
+
+	http.Handle("/api/top", LoggingMiddleware(compressionMiddleware(http.HandlerFunc(topStoriesHandler))))
+	http.Handle("/api/summarize", LoggingMiddleware(rateLimitMiddleware("summarize", compressionMiddleware(http.HandlerFunc(summarizeHandler)))))
+	http.Handle("GET /api/story/{id}", LoggingMiddleware(rateLimitMiddleware("story", compressionMiddleware(http.HandlerFunc(storyHandler)))))
+	http.Handle("GET /api/story/{id}/related", LoggingMiddleware(rateLimitMiddleware("related", compressionMiddleware(http.HandlerFunc(relatedHandler)))))
+	http.Handle("GET /api/archive", LoggingMiddleware(rateLimitMiddleware("archive", compressionMiddleware(http.HandlerFunc(archiveHandler)))))
+	http.Handle("GET /api/search", LoggingMiddleware(rateLimitMiddleware("search", compressionMiddleware(http.HandlerFunc(searchHandler)))))
+	http.Handle("GET /metrics", metricsHandler())
+	http.HandleFunc("GET /healthz", healthzHandler)
+	http.HandleFunc("GET /readyz", readyzHandler)
+	http.Handle("POST /api/admin/backup", LoggingMiddleware(adminAuthMiddleware(http.HandlerFunc(backupHandler))))
+	http.Handle("GET /api/admin/usage", LoggingMiddleware(adminAuthMiddleware(http.HandlerFunc(usageHandler))))
+	http.Handle("/", LoggingMiddleware(http.HandlerFunc(notFoundHandler)))
 
 	logger.Info("http routes registered",
 		"event", "routes_registered",
-		"routes", []string{"/api/top", "/api/summarize"},
+		"routes", []string{"/api/top", "/api/summarize", "/api/story/{id}", "/api/story/{id}/related", "/api/archive", "/api/search", "/api/admin/backup", "/api/admin/usage", "/metrics", "/healthz", "/readyz"},
 	)
 
 	go func() {
@@ -533,11 +997,11 @@ func main() {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
 
-	if dbConn != nil {
+	if store != nil {
 		logger.Info("closing database connection",
 			"event", "db_close_started",
 		)
-		if err := dbConn.Close(); err != nil {
+		if err := store.Close(); err != nil {
 			logger.Error("database close failed",
 				"event", "db_close_failed",
 				"error", err,
@@ -549,6 +1013,13 @@ func main() {
 		}
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("flushing traces failed",
+			"event", "tracing_shutdown_failed",
+			"error", err,
+		)
+	}
+
 	logger.Info("server stopped",
 		"event", "shutdown_completed",
 		"shutdown_duration_ms", time.Since(shutdownStart).Milliseconds(),
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics, served on /metrics. All names are prefixed with hn30_.
+var (
+	refreshDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hn30_refresh_duration_seconds",
+		Help:    "Duration of cache refreshes.",
+		Buckets: []float64{1, 5, 10, 20, 30, 60, 120, 300},
+	})
+
+	refreshesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_refreshes_total",
+		Help: "Cache refreshes by result (success, failure).",
+	}, []string{"result"})
+
+	refreshStageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_refresh_stage_errors_total",
+		Help: "Errors during cache refresh by stage (get_top_story_ids, get_story_details, og_fetch, article_stats, classify_topics, embed, persist_story).",
+	}, []string{"stage"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hn30_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	rateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_rate_limit_rejections_total",
+		Help: "Requests rejected by the rate limiter by route.",
+	}, []string{"route"})
+
+	rateLimitFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "hn30_rate_limit_fallbacks_total",
+		Help: "Times the shared rate limit backend failed and local limiting took over.",
+	})
+
+	summaryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hn30_summary_duration_seconds",
+		Help:    "Latency of summary generation requests to the LLM provider by result.",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30},
+	}, []string{"result"})
+
+	summaryTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_summary_tokens_total",
+		Help: "Tokens used for summaries by type (prompt, completion).",
+	}, []string{"type"})
+
+	llmRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_llm_requests_total",
+		Help: "LLM requests by operation (generate_summary, classify_topics), provider and outcome (success, failure, skipped by an open circuit breaker).",
+	}, []string{"operation", "provider", "outcome"})
+
+	summaryCost = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "hn30_summary_cost_usd_total",
+		Help: "Cost of summaries in USD as reported by OpenRouter or estimated from LLM_PRICES.",
+	})
+
+	notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_notifications_total",
+		Help: "Push notifications by outcome (sent, failed, skipped).",
+	}, []string{"outcome"})
+
+	retentionRowsPruned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hn30_retention_rows_pruned_total",
+		Help: "Rows changed by the retention job by kind (snapshots_downsampled, article_texts_cleared, stories_deleted).",
+	}, []string{"kind"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "hn30_cache_stories",
+		Help: "Number of stories in the in-memory cache.",
+	}, func() float64 {
+		if storyCache == nil {
+			return 0
+		}
+		return float64(storyCache.Len())
+	})
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "hn30_cache_last_updated_timestamp_seconds",
+		Help: "Unix time of the last completed cache refresh, 0 before the first.",
+	}, func() float64 {
+		if storyCache == nil || storyCache.LastUpdated().IsZero() {
+			return 0
+		}
+		return float64(storyCache.LastUpdated().Unix())
+	})
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "hn30_cache_age_seconds",
+		Help: "Seconds since the last completed cache refresh, 0 before the first.",
+	}, func() float64 {
+		if storyCache == nil || storyCache.LastUpdated().IsZero() {
+			return 0
+		}
+		return time.Since(storyCache.LastUpdated()).Seconds()
+	})
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "hn30_rate_limit_buckets",
+		Help: "Number of per-client rate limit buckets held in memory.",
+	}, func() float64 {
+		return float64(localRateLimiter.Len())
+	})
+}
+
+// metricsHandler serves the metrics behind the admin token, since they
+// include LLM spend and traffic per route.
+func metricsHandler() http.Handler {
+	return adminAuthMiddleware(promhttp.Handler())
+}
+
+// routeLabel returns the ServeMux pattern that matched r without its method,
+// so path parameters do not explode label cardinality.
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return path
+	}
+	return pattern
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLoggingMiddlewareRecordsRouteMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/story/{id}", LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Story not found", http.StatusNotFound)
+	})))
+
+	before := testutil.CollectAndCount(httpRequestDuration)
+	for _, path := range []string{"/api/story/1", "/api/story/2"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Both requests share one series labelled with the pattern, not the path.
+	if got := testutil.CollectAndCount(httpRequestDuration) - before; got != 1 {
+		t.Fatalf("expected one new series, got %d", got)
+	}
+}
+
+func TestRateLimitRejectionsCounted(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/api/limited", rateLimitMiddleware("summarize", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	before := testutil.ToFloat64(rateLimitRejections.WithLabelValues("/api/limited"))
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/api/limited", nil)
+		req.RemoteAddr = "203.0.113.9:1234"
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := testutil.ToFloat64(rateLimitRejections.WithLabelValues("/api/limited")) - before; got != 2 {
+		t.Errorf("expected 2 rejections after the burst of 1, got %v", got)
+	}
+}
+
+func TestMetricsNeedAdminToken(t *testing.T) {
+	scrape := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		metricsHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Setenv("ADMIN_TOKEN", "")
+	if rec := scrape(""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 while ADMIN_TOKEN is unset, got %d", rec.Code)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "secret")
+	if rec := scrape("Bearer wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong token, got %d", rec.Code)
+	}
+	rec := scrape("Bearer secret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "hn30_refresh_duration_seconds") {
+		t.Errorf("expected the metrics with the token, got %d", rec.Code)
+	}
+}
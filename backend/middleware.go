@@ -1,19 +1,25 @@
 package main
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"hn30/backend/logging"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
-	"golang.org/x/time/rate"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Create a map to store rate limiters for each visitor
-var visitors = make(map[string]*rate.Limiter)
-var mu sync.Mutex
-
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode   int
@@ -35,26 +41,69 @@ func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// maxRequestIDLength bounds client-supplied request IDs so they cannot bloat
+// logs or response headers.
+const maxRequestIDLength = 128
+
+// requestIDMiddleware gives every request an ID, echoed in the X-Request-ID
+// response header and attached to logs and error bodies. A well-formed
+// X-Request-ID from the client (e.g. set by a proxy) is kept so requests can
+// be followed across services; anything else is replaced with a fresh UUID.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // Unified HTTP logging middleware with structured logging
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		lrw := newLoggingResponseWriter(w)
 
-		// Extract real IP
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+routeLabel(r.Pattern),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", routeLabel(r.Pattern)),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		r = r.WithContext(ctx)
+
+		ip := clientIP(r)
 
-		logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+		logger := logging.FromContext(r.Context()).With(
 			"event_type", "http_request",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_ip", ip,
 		)
 
-		logger.Info("request received",
+		logger.Debug("request received",
 			"event", "request_started",
 			"user_agent", r.UserAgent(),
 			"referer", r.Referer(),
@@ -65,6 +114,13 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		duration := time.Since(start)
 		statusCode := lrw.statusCode
 
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		if statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+
+		httpRequestDuration.WithLabelValues(routeLabel(r.Pattern), r.Method, strconv.Itoa(statusCode)).Observe(duration.Seconds())
+
 		logLevel := slog.LevelInfo
 		if statusCode >= 500 {
 			logLevel = slog.LevelError
@@ -81,58 +137,101 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// Middleware to limit requests from a single IP
-func rateLimitMiddleware(next http.Handler) http.Handler {
+// rateLimitMiddleware limits each client IP under the policy configured for
+// route. Routes without a policy and allow-listed clients pass straight
+// through. Every limited response carries the RateLimit-* headers so clients
+// can pace themselves.
+func rateLimitMiddleware(route string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the real IP address from the X-Forwarded-For header.
-		// This is crucial when running behind a reverse proxy like Traefik.
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			// Fallback to RemoteAddr for local development or direct connections.
-			ip = r.RemoteAddr
+		policy, ok := rateLimits.Policies[route]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+		// Key on the real client, not on the reverse proxy in front of us
+		// or on whatever the client wrote into X-Forwarded-For.
+		ip := clientIP(r)
+
+		logger := logging.FromContext(r.Context()).With(
 			"event_type", "rate_limit",
 			"remote_ip", ip,
 			"path", r.URL.Path,
+			"policy", route,
 		)
 
-		mu.Lock()
-		// Check if the visitor has a limiter yet
-		newVisitor := false
-		if _, found := visitors[ip]; !found {
-			// Allow 10 requests per minute (1 request every 6 seconds)
-			visitors[ip] = rate.NewLimiter(rate.Every(6*time.Second), 1)
-			newVisitor = true
+		if addr, ok := parseIP(ip); ok && containsAddr(rateLimits.Allowlist, addr) {
+			logger.Debug("rate limit skipped for allow-listed client",
+				"event", "rate_limit_allowlisted",
+			)
+			next.ServeHTTP(w, r)
+			return
 		}
-		limiter := visitors[ip]
-		mu.Unlock()
-
-		if newVisitor {
-			logger.Info("new rate limiter created",
-				"event", "rate_limiter_created",
-				"rate", "1 request per 6 seconds",
-				"burst", 1,
+
+		decision, err := rateLimiter.Allow(r.Context(), route+"|"+ip, policy)
+		if err != nil {
+			// Failing open keeps the site up if the limiter backend is down.
+			logger.Error("rate limit check failed, allowing request",
+				"event", "rate_limit_error",
+				"error", err,
 			)
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		// If the visitor's limiter doesn't allow the request, block them.
-		if !limiter.Allow() {
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", policy.Requests, int(policy.Window.Seconds()), policy.Burst))
+		h.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(decision.Reset.Seconds()))))
+
+		if !decision.Allowed {
+			rateLimitRejections.WithLabelValues(routeLabel(r.Pattern)).Inc()
 			logger.Warn("rate limit exceeded",
 				"event", "rate_limit_exceeded",
-				"tokens_available", limiter.Tokens(),
+				"retry_after_ms", decision.RetryAfter.Milliseconds(),
 			)
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			writeErrorRetryAfter(w, r, http.StatusTooManyRequests, "rate_limited", "Too many requests", decision.RetryAfter)
 			return
 		}
 
-		logger.Info("rate limit check passed",
+		logger.Debug("rate limit check passed",
 			"event", "rate_limit_allowed",
-			"tokens_remaining", limiter.Tokens(),
+			"remaining", decision.Remaining,
+		)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminAuthMiddleware guards admin endpoints with the bearer token in
+// ADMIN_TOKEN. When no token is configured the endpoints are disabled.
+func adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context()).With(
+			"event_type", "admin_auth",
+			"path", r.URL.Path,
 		)
 
-		// Otherwise, serve the request
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			logger.Warn("admin endpoint called without ADMIN_TOKEN configured",
+				"event", "admin_disabled",
+			)
+			notFoundHandler(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			logger.Warn("admin authentication failed",
+				"event", "admin_auth_failed",
+			)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, r, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+const defaultPromptFile = "prompts/summary-v1.tmpl"
+
+// promptTemplate is a summary prompt with a "system" and a "user" part.
+// Version names the template and the exact content it was built from, so
+// summaries stored under another version are regenerated.
+type promptTemplate struct {
+	Version string
+	tmpl    *template.Template
+}
+
+// promptData is what templates can refer to.
+type promptData struct {
+	Title       string
+	URL         string
+	Domain      string
+	ArticleText string
+	Points      int
+}
+
+// renderedPrompt is a prompt ready to send.
+type renderedPrompt struct {
+	Version string
+	System  string
+	User    string
+}
+
+// loadPromptTemplate reads the template at path, or the built-in one when
+// path is empty.
+func loadPromptTemplate(path string) (*promptTemplate, error) {
+	var src []byte
+	var err error
+	if path == "" {
+		path = defaultPromptFile
+		src, err = embeddedPrompts.ReadFile(path)
+	} else {
+		src, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePromptTemplate(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), src)
+}
+
+func parsePromptTemplate(name string, src []byte) (*promptTemplate, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range []string{"system", "user"} {
+		if tmpl.Lookup(part) == nil {
+			return nil, fmt.Errorf("prompt template %s: missing {{define %q}}", name, part)
+		}
+	}
+
+	sum := sha256.Sum256(src)
+	return &promptTemplate{
+		Version: name + "@" + hex.EncodeToString(sum[:4]),
+		tmpl:    tmpl,
+	}, nil
+}
+
+func mustLoadPromptTemplate(path string) *promptTemplate {
+	p, err := loadPromptTemplate(path)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Render fills in both parts of the prompt for one article.
+func (p *promptTemplate) Render(data promptData) (renderedPrompt, error) {
+	if data.ArticleText == "" {
+		return renderedPrompt{}, errors.New("Either no article text was provided for summarization or it could not be parsed.")
+	}
+
+	rendered := renderedPrompt{Version: p.Version}
+	for _, part := range []struct {
+		name string
+		dst  *string
+	}{
+		{"system", &rendered.System},
+		{"user", &rendered.User},
+	} {
+		var buf bytes.Buffer
+		if err := p.tmpl.ExecuteTemplate(&buf, part.name, data); err != nil {
+			return renderedPrompt{}, err
+		}
+		*part.dst = strings.TrimSpace(buf.String())
+	}
+	return rendered, nil
+}
+
+// summaryPromptData collects the template fields for story.
+func summaryPromptData(story EnrichedStory, articleText string) promptData {
+	domain := ""
+	if u, err := url.Parse(story.URL); err == nil {
+		domain = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	return promptData{
+		Title:       story.Title,
+		URL:         story.URL,
+		Domain:      domain,
+		ArticleText: articleText,
+		Points:      story.Score,
+	}
+}
+
+// summaryPrompt is the active template, replaced at startup from
+// PROMPT_TEMPLATE.
+var summaryPrompt = mustLoadPromptTemplate("")
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	src := `{{define "system"}}Summarize for {{.Domain}}.{{end}}{{define "user"}}{{.Title}} ({{.Points}} points)
+{{.ArticleText}}{{end}}`
+	p, err := parsePromptTemplate("test-v1", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	story := EnrichedStory{Story: types.Story{Title: "Go 2", URL: "https://www.example.com/post", Score: 321}}
+	rendered, err := p.Render(summaryPromptData(story, "Body text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.System != "Summarize for example.com." || rendered.User != "Go 2 (321 points)\nBody text" {
+		t.Errorf("unexpected prompt %+v", rendered)
+	}
+	if !strings.HasPrefix(rendered.Version, "test-v1@") {
+		t.Errorf("expected the version to start with the template name, got %q", rendered.Version)
+	}
+
+	changed, _ := parsePromptTemplate("test-v1", []byte(src+" "))
+	if changed.Version == p.Version {
+		t.Error("expected any change to the template to change its version")
+	}
+
+	if _, err := parsePromptTemplate("broken", []byte(`{{define "system"}}only system{{end}}`)); err == nil {
+		t.Error("expected a template without a user part to be rejected")
+	}
+	if _, err := p.Render(promptData{}); err == nil {
+		t.Error("expected rendering without article text to fail")
+	}
+}
+
+func TestBuiltinPromptTemplate(t *testing.T) {
+	p, err := loadPromptTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := p.Render(promptData{Title: "T", URL: "https://example.com", Domain: "example.com", ArticleText: "A", Points: 1})
+	if err != nil || rendered.System == "" || !strings.Contains(rendered.User, "example.com") {
+		t.Errorf("unexpected built-in prompt %+v %v", rendered, err)
+	}
+}
+
+func TestSummarizeRegeneratesOutdatedPrompt(t *testing.T) {
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() { storyCache, store = origCache, origStore })
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	var gotMessages []OpenRouterMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenRouterRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		gotMessages = req.Messages
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":   "fresh-model",
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "New summary"}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	useLLMChain(t, "test:fresh-model", map[string]string{"LLM_PROVIDER_TEST_BASE_URL": srv.URL})
+
+	storyCache.Set(7, EnrichedStory{Story: types.Story{ID: 7, Title: "Story", URL: "https://example.com/7", Score: 50}})
+	store.SaveSummary(context.Background(), 7, db.StoredSummary{
+		Summary:       "Old summary",
+		Model:         "old-model",
+		ArticleText:   "Stored article",
+		PromptVersion: "summary-v0@deadbeef",
+	})
+
+	rec := httptest.NewRecorder()
+	summarizeHandler(rec, httptest.NewRequest(http.MethodGet, "/api/summarize?id=7", nil))
+	var resp map[string]string
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp["summary"] != "New summary" || resp["model"] != "fresh-model" {
+		t.Fatalf("expected a regenerated summary, got %d %v", rec.Code, resp)
+	}
+	if len(gotMessages) != 2 || gotMessages[0].Role != "system" || !strings.Contains(gotMessages[1].Content, "Stored article") {
+		t.Errorf("expected the stored article text in a system+user prompt, got %+v", gotMessages)
+	}
+
+	stored, err := store.GetSummary(context.Background(), 7)
+	if err != nil || stored.PromptVersion != summaryPrompt.Version || stored.Summary != "New summary" {
+		t.Errorf("expected the new summary stored with the current version, got %+v %v", stored, err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/logging"
+	"hn30/backend/ratelimit"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRateLimitIdleTTL = 10 * time.Minute
+	defaultRateLimitMaxKeys = 100_000
+	rateLimitSweepInterval  = time.Minute
+
+	// rateLimitRedisTimeout bounds each call to the shared backend; a
+	// limiter that stalls requests is worse than one that falls back.
+	rateLimitRedisTimeout     = 250 * time.Millisecond
+	rateLimitFallbackCooldown = 30 * time.Second
+	rateLimitRedisKeyPrefix   = "hn30:ratelimit:"
+)
+
+// defaultRateLimitPolicies are the per-route limits unless RATE_LIMITS
+// overrides them. Summaries are expensive LLM calls; search hits the
+// database directly; a story missing from the cache and database is fetched
+// from Hacker News and its link scraped, for its related stories too.
+var defaultRateLimitPolicies = map[string]ratelimit.Policy{
+	"summarize": {Requests: 10, Window: time.Minute, Burst: 1},
+	"search":    {Requests: 120, Window: time.Minute, Burst: 20},
+	"story":     {Requests: 60, Window: time.Minute, Burst: 10},
+	"related":   {Requests: 60, Window: time.Minute, Burst: 10},
+	"archive":   {Requests: 60, Window: time.Minute, Burst: 10},
+}
+
+// rateLimitConfig is read from the environment:
+//
+//	RATE_LIMITS           per-route overrides, e.g. "summarize=20/1m:2,search=off"
+//	RATE_LIMIT_ALLOWLIST  CIDRs or IPs that are never limited, e.g. internal services
+//	RATE_LIMIT_IDLE_TTL   how long an idle client's bucket is kept (default 10m),
+//	                      at least as long as any bucket takes to refill
+//	RATE_LIMIT_MAX_KEYS   most buckets held in memory (default 100000)
+//	RATE_LIMIT_REDIS_URL  shares buckets across replicas, e.g. "redis://redis:6379/0"
+type rateLimitConfig struct {
+	Policies  map[string]ratelimit.Policy
+	Allowlist []netip.Prefix
+	IdleTTL   time.Duration
+	MaxKeys   int
+	Redis     *redis.Options
+}
+
+func rateLimitConfigFromEnv() (rateLimitConfig, error) {
+	cfg := rateLimitConfig{
+		Policies: make(map[string]ratelimit.Policy, len(defaultRateLimitPolicies)),
+		IdleTTL:  defaultRateLimitIdleTTL,
+		MaxKeys:  defaultRateLimitMaxKeys,
+	}
+	for route, p := range defaultRateLimitPolicies {
+		cfg.Policies[route] = p
+	}
+
+	if v := os.Getenv("RATE_LIMITS"); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			route, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || route == "" {
+				return cfg, fmt.Errorf("RATE_LIMITS: expected route=policy, got %q", entry)
+			}
+			if spec == "off" {
+				delete(cfg.Policies, route)
+				continue
+			}
+			p, err := ratelimit.ParsePolicy(spec)
+			if err != nil {
+				return cfg, fmt.Errorf("RATE_LIMITS: %w", err)
+			}
+			cfg.Policies[route] = p
+		}
+	}
+
+	if v := os.Getenv("RATE_LIMIT_ALLOWLIST"); v != "" {
+		allowlist, err := parsePrefixes(v)
+		if err != nil {
+			return cfg, fmt.Errorf("RATE_LIMIT_ALLOWLIST: %w", err)
+		}
+		cfg.Allowlist = allowlist
+	}
+
+	if v := os.Getenv("RATE_LIMIT_IDLE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < time.Minute {
+			return cfg, fmt.Errorf("RATE_LIMIT_IDLE_TTL must be a duration of at least 1m, got %q", v)
+		}
+		cfg.IdleTTL = ttl
+	}
+
+	if v := os.Getenv("RATE_LIMIT_MAX_KEYS"); v != "" {
+		maxKeys, err := strconv.Atoi(v)
+		if err != nil || maxKeys < 1 {
+			return cfg, fmt.Errorf("RATE_LIMIT_MAX_KEYS must be a positive integer, got %q", v)
+		}
+		cfg.MaxKeys = maxKeys
+	}
+
+	if v := os.Getenv("RATE_LIMIT_REDIS_URL"); v != "" {
+		opts, err := redis.ParseURL(v)
+		if err != nil {
+			return cfg, fmt.Errorf("RATE_LIMIT_REDIS_URL: %w", err)
+		}
+		opts.DialTimeout = rateLimitRedisTimeout
+		opts.ReadTimeout = rateLimitRedisTimeout
+		opts.WriteTimeout = rateLimitRedisTimeout
+		opts.MaxRetries = -1
+		cfg.Redis = opts
+	}
+
+	// An evicted bucket must already have refilled, or a client that goes
+	// quiet gets a fresh burst early.
+	for route, p := range cfg.Policies {
+		if full := time.Duration(p.Burst) * p.Interval(); cfg.IdleTTL < full {
+			return cfg, fmt.Errorf("RATE_LIMIT_IDLE_TTL %s is shorter than the %s it takes the %s bucket to refill", cfg.IdleTTL, full, route)
+		}
+	}
+
+	return cfg, nil
+}
+
+// rateLimits holds the active configuration and rateLimiter decides. With a
+// shared backend, localRateLimiter is the fallback; otherwise the two are
+// the same. All are replaced by setupRateLimiting at startup.
+var (
+	rateLimits                         = rateLimitConfig{Policies: defaultRateLimitPolicies, IdleTTL: defaultRateLimitIdleTTL, MaxKeys: defaultRateLimitMaxKeys}
+	localRateLimiter                   = ratelimit.NewLocal(defaultRateLimitIdleTTL, defaultRateLimitMaxKeys)
+	rateLimiter      ratelimit.Limiter = localRateLimiter
+)
+
+// setupRateLimiting installs cfg and starts evicting idle buckets. If a
+// shared backend is configured it is used first, with the local buckets as a
+// fallback while it is unreachable.
+func setupRateLimiting(cfg rateLimitConfig) {
+	logger := logging.L().With(
+		"event_type", "rate_limit",
+	)
+
+	local := ratelimit.NewLocal(cfg.IdleTTL, cfg.MaxKeys)
+	rateLimits, localRateLimiter, rateLimiter = cfg, local, local
+
+	backend := "local"
+	if cfg.Redis != nil {
+		backend = "redis"
+		rateLimiter = newSharedRateLimiter(cfg.Redis, local)
+	}
+
+	policies := make(map[string]string, len(cfg.Policies))
+	for route, p := range cfg.Policies {
+		policies[route] = p.String()
+	}
+	logger.Info("rate limiting configured",
+		"event", "rate_limit_configured",
+		"policies", policies,
+		"allowlist", len(cfg.Allowlist),
+		"idle_ttl", cfg.IdleTTL.String(),
+		"max_keys", cfg.MaxKeys,
+		"backend", backend,
+	)
+
+	go func() {
+		ticker := time.NewTicker(rateLimitSweepInterval)
+		for range ticker.C {
+			if removed := local.Sweep(); removed > 0 {
+				logger.Debug("idle rate limit buckets evicted",
+					"event", "rate_limit_buckets_evicted",
+					"evicted", removed,
+					"remaining", local.Len(),
+				)
+			}
+		}
+	}()
+}
+
+// newSharedRateLimiter connects to the Redis-protocol server in opts. The
+// connection is checked once so a misconfiguration shows up in the startup
+// logs, but an unreachable server is not fatal: requests are limited locally
+// until it comes back.
+func newSharedRateLimiter(opts *redis.Options, local *ratelimit.Local) ratelimit.Limiter {
+	logger := logging.L().With(
+		"event_type", "rate_limit",
+		"redis_addr", opts.Addr,
+	)
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		logger.Warn("rate limit backend unreachable, limiting locally until it recovers",
+			"event", "rate_limit_backend_unreachable",
+			"error", err,
+		)
+	}
+
+	fallback := ratelimit.NewFallback(ratelimit.NewRedis(client, rateLimitRedisKeyPrefix), local, rateLimitFallbackCooldown)
+	fallback.OnFallback = func(ctx context.Context, err error) {
+		rateLimitFallbacks.Inc()
+		logging.FromContext(ctx).Warn("rate limit backend failed, falling back to local limiting",
+			"event_type", "rate_limit",
+			"event", "rate_limit_backend_failed",
+			"redis_addr", opts.Addr,
+			"error", err,
+			"retry_in", rateLimitFallbackCooldown.String(),
+		)
+	}
+	return fallback
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Fallback uses a shared primary limiter and falls back to a local one when
+// the primary fails. After a failure the primary is left alone for the
+// cooldown, so an outage costs one slow request per cooldown rather than one
+// per request.
+type Fallback struct {
+	primary   Limiter
+	secondary Limiter
+	cooldown  time.Duration
+	// retryAt is the Unix nanosecond time before which the primary is
+	// skipped.
+	retryAt atomic.Int64
+	now     func() time.Time
+
+	// OnFallback, if set, is called with the primary's error each time it
+	// fails.
+	OnFallback func(ctx context.Context, err error)
+}
+
+// NewFallback returns a limiter that prefers primary and uses secondary
+// while primary is unavailable.
+func NewFallback(primary, secondary Limiter, cooldown time.Duration) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary, cooldown: cooldown, now: time.Now}
+}
+
+// Allow implements Limiter. It only returns an error if both limiters fail.
+func (f *Fallback) Allow(ctx context.Context, key string, p Policy) (Decision, error) {
+	if f.now().UnixNano() >= f.retryAt.Load() {
+		d, err := f.primary.Allow(ctx, key, p)
+		if err == nil {
+			return d, nil
+		}
+		f.retryAt.Store(f.now().Add(f.cooldown).UnixNano())
+		if f.OnFallback != nil {
+			f.OnFallback(ctx, err)
+		}
+	}
+	return f.secondary.Allow(ctx, key, p)
+}
+
+// Degraded reports whether the primary is currently being skipped.
+func (f *Fallback) Degraded() bool {
+	return f.now().UnixNano() < f.retryAt.Load()
+}
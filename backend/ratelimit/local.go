@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Local keeps a token bucket per key in memory. Buckets idle for longer than
+// the idle TTL are evicted by Sweep, and the number of buckets is capped, so
+// memory stays bounded however many clients show up. An idle bucket is
+// refilled by the time it is evicted as long as the TTL is at least
+// Burst*Interval, so eviction never gives a client more than it is owed.
+type Local struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	idleTTL time.Duration
+	maxKeys int
+	now     func() time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	policy   Policy
+	lastSeen time.Time
+}
+
+// NewLocal returns an in-memory limiter holding at most maxKeys buckets.
+func NewLocal(idleTTL time.Duration, maxKeys int) *Local {
+	return &Local{
+		buckets: make(map[string]*bucket),
+		idleTTL: idleTTL,
+		maxKeys: maxKeys,
+		now:     time.Now,
+	}
+}
+
+// Allow implements Limiter. It never returns an error.
+func (l *Local) Allow(ctx context.Context, key string, p Policy) (Decision, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok || b.policy != p {
+		if !ok && len(l.buckets) >= l.maxKeys {
+			l.evictOldest()
+		}
+		b = &bucket{limiter: rate.NewLimiter(p.limit(), p.Burst), policy: p}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	return decide(b.limiter, p, now), nil
+}
+
+// evictOldest drops the least recently used bucket. It only runs when the
+// cap is hit, so the linear scan is rare.
+func (l *Local) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, b := range l.buckets {
+		if oldestKey == "" || b.lastSeen.Before(oldest) {
+			oldestKey, oldest = key, b.lastSeen
+		}
+	}
+	delete(l.buckets, oldestKey)
+}
+
+// Sweep evicts buckets idle for longer than the idle TTL and returns how
+// many were removed.
+func (l *Local) Sweep() int {
+	cutoff := l.now().Add(-l.idleTTL)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	removed := 0
+	for key, b := range l.buckets {
+		if b.lastSeen.Before(cutoff) {
+			delete(l.buckets, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of buckets held.
+func (l *Local) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
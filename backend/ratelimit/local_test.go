@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalAllow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewLocal(10*time.Minute, 100)
+	l.now = func() time.Time { return now }
+	p := Policy{Requests: 10, Window: time.Minute, Burst: 2}
+
+	for i := range 2 {
+		d, _ := l.Allow(context.Background(), "a", p)
+		if !d.Allowed || d.Remaining != 1-i {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %+v", i, 1-i, d)
+		}
+	}
+
+	d, _ := l.Allow(context.Background(), "a", p)
+	if d.Allowed || d.RetryAfter != 6*time.Second || d.Reset != 12*time.Second {
+		t.Errorf("expected a rejection due in 6s with a full reset in 12s, got %+v", d)
+	}
+
+	if d, _ := l.Allow(context.Background(), "b", p); !d.Allowed {
+		t.Error("expected keys to have separate buckets")
+	}
+
+	now = now.Add(6 * time.Second)
+	if d, _ := l.Allow(context.Background(), "a", p); !d.Allowed {
+		t.Errorf("expected a token after the interval, got %+v", d)
+	}
+}
+
+func TestLocalEviction(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewLocal(time.Minute, 2)
+	l.now = func() time.Time { return now }
+	p := Policy{Requests: 1, Window: time.Second, Burst: 1}
+
+	l.Allow(context.Background(), "old", p)
+	now = now.Add(30 * time.Second)
+	l.Allow(context.Background(), "mid", p)
+	now = now.Add(time.Second)
+	l.Allow(context.Background(), "new", p)
+
+	if l.Len() != 2 {
+		t.Fatalf("expected the cap to hold 2 buckets, got %d", l.Len())
+	}
+	if _, ok := l.buckets["old"]; ok {
+		t.Error("expected the least recently used bucket to be evicted")
+	}
+
+	now = now.Add(59*time.Second + 500*time.Millisecond)
+	if removed := l.Sweep(); removed != 1 || l.Len() != 1 {
+		t.Errorf("expected the idle bucket to be swept, removed %d, %d left", removed, l.Len())
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("120/1m:20")
+	if err != nil || p != (Policy{Requests: 120, Window: time.Minute, Burst: 20}) || p.Interval() != 500*time.Millisecond {
+		t.Errorf("unexpected policy %+v %v", p, err)
+	}
+	if p, err := ParsePolicy("10/1m"); err != nil || p.Burst != 1 {
+		t.Errorf("expected a default burst of 1, got %+v %v", p, err)
+	}
+	for _, bad := range []string{"10", "0/1m", "10/soon", "10/1m:0"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
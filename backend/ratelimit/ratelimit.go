@@ -0,0 +1,100 @@
+// Package ratelimit implements token-bucket rate limiting keyed by an
+// arbitrary string, typically a route name and a client IP.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Policy allows Requests per Window on average, with bursts of up to Burst
+// requests.
+type Policy struct {
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+// ParsePolicy parses "requests/window" with an optional ":burst", e.g.
+// "10/1m" or "120/1m:20". The burst defaults to 1.
+func ParsePolicy(s string) (Policy, error) {
+	spec, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	requests, window, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit policy %q: expected requests/window", s)
+	}
+
+	p := Policy{Burst: 1}
+	var err error
+	if p.Requests, err = strconv.Atoi(requests); err != nil || p.Requests < 1 {
+		return Policy{}, fmt.Errorf("rate limit policy %q: requests must be a positive integer", s)
+	}
+	if p.Window, err = time.ParseDuration(window); err != nil || p.Window <= 0 {
+		return Policy{}, fmt.Errorf("rate limit policy %q: window must be a positive duration", s)
+	}
+	if hasBurst {
+		if p.Burst, err = strconv.Atoi(burstSpec); err != nil || p.Burst < 1 {
+			return Policy{}, fmt.Errorf("rate limit policy %q: burst must be a positive integer", s)
+		}
+	}
+	return p, nil
+}
+
+// Interval is the time it takes to earn back one request.
+func (p Policy) Interval() time.Duration {
+	return p.Window / time.Duration(p.Requests)
+}
+
+func (p Policy) limit() rate.Limit {
+	return rate.Every(p.Interval())
+}
+
+// String formats p the way ParsePolicy reads it.
+func (p Policy) String() string {
+	return fmt.Sprintf("%d/%s:%d", p.Requests, p.Window, p.Burst)
+}
+
+// Decision is the outcome of one rate limit check.
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket size, i.e. the burst.
+	Limit int
+	// Remaining is the number of requests that would be allowed right now.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed. It is only
+	// set when Allowed is false.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether the request identified by key may proceed under p.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string, p Policy) (Decision, error)
+}
+
+// decide takes one token from lim at now, or reports how long until one is
+// available without consuming anything.
+func decide(lim *rate.Limiter, p Policy, now time.Time) Decision {
+	d := Decision{Limit: p.Burst}
+
+	reservation := lim.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		d.RetryAfter = delay
+	} else {
+		d.Allowed = true
+	}
+
+	tokens := lim.TokensAt(now)
+	d.Remaining = max(int(math.Floor(tokens)), 0)
+	d.Reset = time.Duration((float64(p.Burst) - tokens) * float64(p.Interval()))
+	return d
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript implements the generic cell rate algorithm, which is
+// equivalent to a token bucket but needs only one value per key: the
+// theoretical arrival time (TAT) of the next request, in milliseconds. The
+// key expires once the bucket would be full again, so idle clients cost
+// nothing.
+//
+// KEYS[1] bucket key; ARGV: now_ms, interval_ms, burst.
+// Returns {allowed, remaining, reset_ms, retry_after_ms}.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local capacity = interval * burst
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - capacity
+if now < allow_at then
+	return {0, math.floor((capacity - (tat - now)) / interval), tat - now, allow_at - now}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", new_tat - now)
+return {1, math.floor((capacity - (new_tat - now)) / interval), new_tat - now, 0}
+`)
+
+// Redis keeps buckets in a Redis-protocol server, so every replica shares
+// one quota per client.
+type Redis struct {
+	client redis.Scripter
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedis returns a limiter storing buckets under keys starting with prefix.
+func NewRedis(client redis.Scripter, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix, now: time.Now}
+}
+
+// Allow implements Limiter. It returns an error if the server is unreachable.
+func (l *Redis) Allow(ctx context.Context, key string, p Policy) (Decision, error) {
+	res, err := gcraScript.Run(ctx, l.client, []string{l.prefix + key},
+		l.now().UnixMilli(), p.Interval().Milliseconds(), p.Burst,
+	).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(res) != 4 {
+		return Decision{}, fmt.Errorf("ratelimit: unexpected script result %v", res)
+	}
+
+	return Decision{
+		Allowed:    res[0] == 1,
+		Limit:      p.Burst,
+		Remaining:  max(int(res[1]), 0),
+		Reset:      time.Duration(res[2]) * time.Millisecond,
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis, *time.Time) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Unix(1_700_000_000, 0)
+	l := NewRedis(client, "test:")
+	l.now = func() time.Time { return now }
+	return l, srv, &now
+}
+
+func TestRedisAllow(t *testing.T) {
+	l, srv, now := newTestRedis(t)
+	p := Policy{Requests: 10, Window: time.Minute, Burst: 2}
+	ctx := context.Background()
+
+	for i := range 2 {
+		d, err := l.Allow(ctx, "a", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Allowed || d.Remaining != 1-i {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %+v", i, 1-i, d)
+		}
+	}
+
+	d, err := l.Allow(ctx, "a", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed || d.RetryAfter != 6*time.Second || d.Reset != 12*time.Second || d.Remaining != 0 {
+		t.Errorf("expected a rejection due in 6s with a full reset in 12s, got %+v", d)
+	}
+
+	if ttl := srv.TTL("test:a"); ttl <= 0 || ttl > 12*time.Second {
+		t.Errorf("expected the key to expire once the bucket refills, got TTL %v", ttl)
+	}
+
+	// A second replica sharing the server sees the same bucket.
+	other := NewRedis(redis.NewClient(&redis.Options{Addr: srv.Addr()}), "test:")
+	other.now = l.now
+	if d, _ := other.Allow(ctx, "a", p); d.Allowed {
+		t.Error("expected replicas to share one quota")
+	}
+
+	*now = now.Add(6 * time.Second)
+	if d, _ := l.Allow(ctx, "a", p); !d.Allowed {
+		t.Errorf("expected a token after the interval, got %+v", d)
+	}
+}
+
+type failingLimiter struct{ calls int }
+
+func (f *failingLimiter) Allow(context.Context, string, Policy) (Decision, error) {
+	f.calls++
+	return Decision{}, errors.New("connection refused")
+}
+
+func TestFallback(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	primary := &failingLimiter{}
+	f := NewFallback(primary, NewLocal(time.Minute, 10), 30*time.Second)
+	f.now = func() time.Time { return now }
+
+	var fallbacks int
+	f.OnFallback = func(context.Context, error) { fallbacks++ }
+
+	p := Policy{Requests: 1, Window: time.Minute, Burst: 1}
+	if d, err := f.Allow(context.Background(), "a", p); err != nil || !d.Allowed {
+		t.Fatalf("expected the local limiter to answer, got %+v %v", d, err)
+	}
+	if d, _ := f.Allow(context.Background(), "a", p); d.Allowed {
+		t.Error("expected the local limiter to enforce the policy")
+	}
+	if primary.calls != 1 || fallbacks != 1 || !f.Degraded() {
+		t.Errorf("expected the primary to be skipped during the cooldown, got %d calls", primary.calls)
+	}
+
+	now = now.Add(31 * time.Second)
+	f.Allow(context.Background(), "b", p)
+	if primary.calls != 2 {
+		t.Errorf("expected the primary to be retried after the cooldown, got %d calls", primary.calls)
+	}
+}
+
+func TestFallbackRecovers(t *testing.T) {
+	l, srv, _ := newTestRedis(t)
+	f := NewFallback(l, NewLocal(time.Minute, 10), 0)
+	p := Policy{Requests: 1, Window: time.Minute, Burst: 1}
+
+	srv.SetError("LOADING")
+	if _, err := f.Allow(context.Background(), "a", p); err != nil {
+		t.Fatalf("expected the fallback to hide the backend error, got %v", err)
+	}
+
+	srv.SetError("")
+	if _, err := f.Allow(context.Background(), "a", p); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Exists("test:a") {
+		t.Error("expected the shared backend to be used again once it recovers")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"hn30/backend/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	origLimits, origLimiter := rateLimits, rateLimiter
+	t.Cleanup(func() { rateLimits, rateLimiter = origLimits, origLimiter })
+
+	rateLimits = rateLimitConfig{
+		Policies:  map[string]ratelimit.Policy{"limited": {Requests: 2, Window: time.Minute, Burst: 2}},
+		Allowlist: mustParsePrefixes("198.51.100.0/24"),
+	}
+	rateLimiter = ratelimit.NewLocal(time.Minute, 100)
+
+	serve := func(route, remoteAddr string) *httptest.ResponseRecorder {
+		handler := rateLimitMiddleware(route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("limited", "203.0.113.1:1000")
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("expected RateLimit headers on an allowed request, got %d %v", rec.Code, rec.Header())
+	}
+	if got := rec.Header().Get("RateLimit-Policy"); got != "2;w=60;burst=2" {
+		t.Errorf("unexpected RateLimit-Policy %q", got)
+	}
+
+	serve("limited", "203.0.113.1:1001")
+	rec = serve("limited", "203.0.113.1:1002")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected a 429 with Retry-After 30, got %d %v", rec.Code, rec.Header())
+	}
+
+	for range 5 {
+		if rec := serve("limited", "198.51.100.9:1000"); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("expected allow-listed clients to bypass the limit, got %d", rec.Code)
+		}
+		if rec := serve("unlimited", "203.0.113.1:1000"); rec.Code != http.StatusOK {
+			t.Fatalf("expected routes without a policy to pass, got %d", rec.Code)
+		}
+	}
+}
+
+func TestRateLimitConfigFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMITS", "summarize=20/1m:2,search=off")
+	t.Setenv("RATE_LIMIT_ALLOWLIST", "10.0.0.0/8")
+
+	cfg, err := rateLimitConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := cfg.Policies["summarize"]; p.Requests != 20 || p.Burst != 2 {
+		t.Errorf("expected the summarize override, got %+v", p)
+	}
+	if _, ok := cfg.Policies["search"]; ok {
+		t.Error("expected search to be unlimited")
+	}
+	if p := cfg.Policies["story"]; p.Requests != 60 || p.Burst != 10 {
+		t.Errorf("expected the story default to be kept, got %+v", p)
+	}
+	if p := cfg.Policies["related"]; p.Requests != 60 || p.Burst != 10 {
+		t.Errorf("expected related stories to have their own limit, got %+v", p)
+	}
+	if p := cfg.Policies["archive"]; p.Requests != 60 || p.Burst != 10 {
+		t.Errorf("expected the archive to be limited by default, got %+v", p)
+	}
+	if len(cfg.Allowlist) != 1 || defaultRateLimitPolicies["search"].Requests == 0 {
+		t.Error("expected the allow-list to be parsed without touching the defaults")
+	}
+
+	if cfg.Redis != nil {
+		t.Error("expected no shared backend unless RATE_LIMIT_REDIS_URL is set")
+	}
+
+	t.Setenv("RATE_LIMIT_REDIS_URL", "redis://redis:6379/2")
+	if cfg, err := rateLimitConfigFromEnv(); err != nil || cfg.Redis.Addr != "redis:6379" || cfg.Redis.DB != 2 {
+		t.Errorf("expected the Redis URL to be parsed, got %+v %v", cfg.Redis, err)
+	}
+
+	t.Setenv("RATE_LIMITS", "summarize")
+	if _, err := rateLimitConfigFromEnv(); err == nil {
+		t.Error("expected a malformed policy to be rejected")
+	}
+
+	t.Setenv("RATE_LIMITS", "summarize=10/1h:10")
+	if _, err := rateLimitConfigFromEnv(); err == nil {
+		t.Error("expected an idle TTL shorter than the refill time to be rejected")
+	}
+	t.Setenv("RATE_LIMIT_IDLE_TTL", "1h")
+	if _, err := rateLimitConfigFromEnv(); err != nil {
+		t.Errorf("expected an idle TTL covering the refill time to be accepted, got %v", err)
+	}
+}
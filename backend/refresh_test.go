@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakeHN serves a two-story top list: story 1 is old and popular enough
+// to be pushed, story 2 is brand new. Both link to article pages on the same
+// server; articleHits counts how often those are scraped. Story 3, off the
+// list, is dead.
+func newFakeHN(t *testing.T, articleHits *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	now := time.Now().Unix()
+	mux := http.NewServeMux()
+	var server *httptest.Server
+
+	mux.HandleFunc("/topstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[1, 2]`)
+	})
+	mux.HandleFunc("/item/1.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"title":"A very popular story","url":"%s/article/1","score":700,"by":"pg","time":%d,"descendants":120}`,
+			server.URL, now-2*60*60)
+	})
+	mux.HandleFunc("/item/2.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":2,"title":"A brand new story","url":"%s/article/2","score":12,"by":"dang","time":%d,"descendants":3}`,
+			server.URL, now-60)
+	})
+	mux.HandleFunc("/item/3.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":3,"title":"A flagged story","url":"%s/article/3","dead":true,"time":%d}`, server.URL, now)
+	})
+	mux.HandleFunc("/article/", func(w http.ResponseWriter, r *http.Request) {
+		articleHits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head>
+			<meta property="og:image" content="/image.png">
+			<meta property="og:description" content="An article worth reading.">
+		</head><body></body></html>`)
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRefreshCache(t *testing.T) {
+	var articleHits atomic.Int32
+	server := newFakeHN(t, &articleHits)
+
+	notifications := make(chan int, 10)
+
+	origBaseURL, origDelay, origPush := hnBaseURL, scrapeDelay, pushNotification
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() {
+		hnBaseURL, scrapeDelay, pushNotification = origBaseURL, origDelay, origPush
+		storyCache, store = origCache, origStore
+	})
+
+	hnBaseURL = server.URL
+	scrapeDelay = 0
+	pushNotification = func(ctx context.Context, s EnrichedStory) { notifications <- s.ID }
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	refreshCache()
+
+	stories := storyCache.GetAll()
+	if len(stories) != 2 {
+		t.Fatalf("expected 2 cached stories, got %d", len(stories))
+	}
+	if stories[0].ID != 1 || stories[1].ID != 2 {
+		t.Errorf("expected stories in top list order, got %d, %d", stories[0].ID, stories[1].ID)
+	}
+	if stories[0].OGImage != server.URL+"/image.png" {
+		t.Errorf("expected resolved og:image, got %q", stories[0].OGImage)
+	}
+
+	stored, err := store.GetStory(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected story 1 to be persisted, got %v", err)
+	}
+	if stored.OGDescription != "An article worth reading." || stored.By != "pg" {
+		t.Errorf("unexpected persisted story: %+v", stored)
+	}
+
+	archive, err := store.Archive(context.Background(), time.Now(), time.Now())
+	if err != nil {
+		t.Fatalf("expected no archive error, got %v", err)
+	}
+	if len(archive) != 2 || archive[0].ID != 1 || archive[0].BestRank != 1 {
+		t.Errorf("expected both stories in today's archive ranked by points, got %+v", archive)
+	}
+
+	select {
+	case id := <-notifications:
+		if id != 1 {
+			t.Errorf("expected a notification for story 1, got story %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a notification for story 1")
+	}
+
+	// A second run reuses the cached OG data and must not notify again.
+	refreshCache()
+
+	if hits := articleHits.Load(); hits != 2 {
+		t.Errorf("expected articles to be scraped once each, got %d scrapes", hits)
+	}
+
+	select {
+	case id := <-notifications:
+		t.Errorf("expected no repeated notification, got one for story %d", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRefreshKeepsSelfPostText(t *testing.T) {
+	var itemHits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/topstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[3]`)
+	})
+	mux.HandleFunc("/item/3.json", func(w http.ResponseWriter, r *http.Request) {
+		itemHits.Add(1)
+		fmt.Fprintf(w, `{"id":3,"title":"Ask HN: How do you take notes?","text":"I keep losing track of things.<p>What works for you?","score":40,"by":"pg","time":%d}`, time.Now().Unix())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	origBaseURL, origDelay, origPush, origOnRefresh := hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() {
+		hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh = origBaseURL, origDelay, origPush, origOnRefresh
+		storyCache, store = origCache, origStore
+	})
+	hnBaseURL = server.URL
+	scrapeDelay = 0
+	pushNotification = func(ctx context.Context, s EnrichedStory) {}
+	articleStatsOnRefresh = true
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	refreshCache()
+
+	story, found := storyCache.Get(3)
+	if !found {
+		t.Fatal("expected the self post to be cached")
+	}
+	if story.URL != "https://news.ycombinator.com/item?id=3" {
+		t.Errorf("expected the item page as URL, got %q", story.URL)
+	}
+	if story.ArticleText != "Ask HN: How do you take notes?\n\nI keep losing track of things.\n\nWhat works for you?" {
+		t.Errorf("expected the item text as article text, got %q", story.ArticleText)
+	}
+	if story.OGDescription != "I keep losing track of things." || story.WordCount == 0 {
+		t.Errorf("expected a description and stats from the item text, got %+v", story)
+	}
+	if hits := itemHits.Load(); hits != 1 {
+		t.Errorf("expected the item to be fetched once, got %d", hits)
+	}
+}
+
+func TestFindStoryDescribesSelfPosts(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/item/3.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":3,"title":"Ask HN: How do you take notes?","text":"I keep losing track of things.<p>What works for you?","score":40,"by":"pg","time":%d}`, time.Now().Unix())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	origBaseURL, origCache, origStore, origLive := hnBaseURL, storyCache, store, liveStories
+	t.Cleanup(func() { hnBaseURL, storyCache, store, liveStories = origBaseURL, origCache, origStore, origLive })
+	hnBaseURL = server.URL
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+	liveStories = NewLiveCache(liveStoryTTL, liveStoryMaxEntries)
+
+	// Fetched live, a self post gets the same description as when it is
+	// refreshed, without scraping the item page.
+	story, source, err := findStory(context.Background(), 3)
+	if err != nil || source != "hacker_news" {
+		t.Fatalf("findStory: %s, %v", source, err)
+	}
+	if story.OGDescription != "I keep losing track of things." || story.ArticleText == "" {
+		t.Errorf("expected the description and text from the item, got %+v", story)
+	}
+}
+
+func TestStoryHandlerSources(t *testing.T) {
+	var articleHits atomic.Int32
+	server := newFakeHN(t, &articleHits)
+
+	origBaseURL, origCache, origStore, origLive := hnBaseURL, storyCache, store, liveStories
+	t.Cleanup(func() { hnBaseURL, storyCache, store, liveStories = origBaseURL, origCache, origStore, origLive })
+	hnBaseURL = server.URL
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+	liveStories = NewLiveCache(liveStoryTTL, liveStoryMaxEntries)
+
+	storyCache.Set(10, EnrichedStory{Story: types.Story{ID: 10, Title: "On the front page"}})
+	if err := store.UpsertStory(context.Background(), types.Story{ID: 11, Title: "Seen last week"}); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+
+	get := func(id int) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/story/%d", id), nil)
+		req.SetPathValue("id", strconv.Itoa(id))
+		storyHandler(rec, req)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		id     int
+		source string
+		title  string
+	}{
+		{10, "cache", "On the front page"},
+		{11, "database", "Seen last week"},
+		{1, "hacker_news", "A very popular story"},
+		// Served from the live cache, without fetching the link again.
+		{1, "hacker_news", "A very popular story"},
+	} {
+		rec := get(tt.id)
+		var story EnrichedStory
+		if err := json.NewDecoder(rec.Body).Decode(&story); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("story %d: status %d, %v", tt.id, rec.Code, err)
+		}
+		if got := rec.Header().Get("X-Story-Source"); got != tt.source || story.Title != tt.title {
+			t.Errorf("story %d: got %q from %s, want %q from %s", tt.id, story.Title, got, tt.title, tt.source)
+		}
+	}
+	if hits := articleHits.Load(); hits != 1 {
+		t.Errorf("expected the live story to be scraped once, got %d", hits)
+	}
+
+	if rec := get(3); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a dead story, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/logging"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultRetentionInterval = 24 * time.Hour
+
+// retentionConfig is read from the environment:
+//
+//	RETENTION_INTERVAL           how often the job runs (default 24h, 0 disables)
+//	RETENTION_SNAPSHOT_DAYS      full-detail snapshot history (default 90)
+//	RETENTION_ARTICLE_TEXT_DAYS  article text kept next to summaries (default 30)
+//	RETENTION_STORY_DAYS         stories not seen for this long are deleted (default 0, keep forever)
+type retentionConfig struct {
+	Interval time.Duration
+	Policy   db.RetentionPolicy
+}
+
+func retentionConfigFromEnv() (retentionConfig, error) {
+	cfg := retentionConfig{
+		Interval: defaultRetentionInterval,
+		Policy: db.RetentionPolicy{
+			SnapshotMaxAge:    90 * 24 * time.Hour,
+			ArticleTextMaxAge: 30 * 24 * time.Hour,
+		},
+	}
+
+	if v := os.Getenv("RETENTION_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return cfg, fmt.Errorf("RETENTION_INTERVAL must be a duration, got %q", v)
+		}
+		cfg.Interval = interval
+	}
+
+	days := []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"RETENTION_SNAPSHOT_DAYS", &cfg.Policy.SnapshotMaxAge},
+		{"RETENTION_ARTICLE_TEXT_DAYS", &cfg.Policy.ArticleTextMaxAge},
+		{"RETENTION_STORY_DAYS", &cfg.Policy.StoryMaxAge},
+	}
+	for _, d := range days {
+		v := os.Getenv(d.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("%s must be a number of days, got %q", d.env, v)
+		}
+		*d.dst = time.Duration(n) * 24 * time.Hour
+	}
+
+	return cfg, nil
+}
+
+// runRetention applies the policy once and records the rows it changed in
+// hn30_retention_rows_pruned_total.
+func runRetention(ctx context.Context, s db.Store, cfg retentionConfig) (db.PruneResult, error) {
+	result, err := s.Prune(ctx, cfg.Policy, time.Now())
+	if err != nil {
+		return result, err
+	}
+
+	retentionRowsPruned.WithLabelValues("snapshots_downsampled").Add(float64(result.SnapshotsDownsampled))
+	retentionRowsPruned.WithLabelValues("article_texts_cleared").Add(float64(result.ArticleTextsCleared))
+	retentionRowsPruned.WithLabelValues("stories_deleted").Add(float64(result.StoriesDeleted))
+
+	return result, nil
+}
+
+func startRetentionJob(cfg retentionConfig) {
+	logger := logging.L().With(
+		"event_type", "retention_job",
+	)
+
+	if cfg.Interval == 0 {
+		logger.Info("retention job disabled",
+			"event", "retention_job_disabled",
+		)
+		return
+	}
+
+	logger.Info("retention job running",
+		"event", "retention_job_started",
+		"interval", cfg.Interval.String(),
+		"snapshot_days", int(cfg.Policy.SnapshotMaxAge.Hours()/24),
+		"article_text_days", int(cfg.Policy.ArticleTextMaxAge.Hours()/24),
+		"story_days", int(cfg.Policy.StoryMaxAge.Hours()/24),
+	)
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		for range ticker.C {
+			start := time.Now()
+			result, err := runRetention(context.Background(), store, cfg)
+			if err != nil {
+				logger.Error("retention run failed",
+					"event", "retention_run_failed",
+					"error", err,
+					"duration_ms", time.Since(start).Milliseconds(),
+				)
+				continue
+			}
+
+			logger.Info("retention run completed",
+				"event", "retention_run_completed",
+				"snapshots_downsampled", result.SnapshotsDownsampled,
+				"article_texts_cleared", result.ArticleTextsCleared,
+				"stories_deleted", result.StoriesDeleted,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		}
+	}()
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"hn30/backend/logging"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -17,8 +18,8 @@ var scraperClient = &http.Client{
 	Timeout: 20 * time.Second, // Reduced from 30s to fail faster
 }
 
-func getOGData(storyUrl string) (string, string, error) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+func getOGData(ctx context.Context, storyUrl string) (string, string, error) {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "scraper_operation",
 		"operation", "get_og_data",
 		"url", storyUrl,
@@ -43,13 +44,13 @@ func getOGData(storyUrl string) (string, string, error) {
 		return "", "", fmt.Errorf("invalid URL scheme")
 	}
 
-	logger.Info("scraping og data",
+	logger.Debug("scraping og data",
 		"event", "scrape_started",
 		"domain", parsedURL.Host,
 	)
 
 	// Create context with timeout for better control
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 8*time.Second)
 	defer cancel()
 
 	// Use an explicit request so we can set a proper User-Agent.
@@ -86,7 +87,7 @@ func getOGData(storyUrl string) (string, string, error) {
 
 	// Check for redirects to potentially problematic URLs
 	if res.Request.URL.String() != storyUrl {
-		logger.Info("redirect detected",
+		logger.Debug("redirect detected",
 			"event", "redirect_detected",
 			"original_url", storyUrl,
 			"final_url", res.Request.URL.String(),
@@ -104,10 +105,14 @@ func getOGData(storyUrl string) (string, string, error) {
 		// Still try to parse - some sites return OG data even on 404s
 	}
 
-	// Check content type - skip if not HTML-like
+	// Limit response body size to prevent memory issues
+	body := bufio.NewReader(http.MaxBytesReader(nil, res.Body, maxDocumentSize))
+	head, _ := body.Peek(512)
+
 	contentType := res.Header.Get("Content-Type")
-	if contentType != "" && !strings.Contains(strings.ToLower(contentType), "html") {
-		logger.Info("non-html content type",
+	kind := documentKind(contentType, res.Request.URL, head)
+	if kind == "" {
+		logger.Info("unsupported content type",
 			"event", "content_type_skip",
 			"content_type", contentType,
 			"status_code", res.StatusCode,
@@ -116,16 +121,39 @@ func getOGData(storyUrl string) (string, string, error) {
 		return "", "", nil // Return empty but no error - not a failure
 	}
 
-	logger.Info("response received",
+	logger.Debug("response received",
 		"event", "response_received",
 		"status_code", res.StatusCode,
 		"content_type", contentType,
+		"document_kind", kind,
 		"content_length", res.ContentLength,
 	)
 
-	// Limit response body size to prevent memory issues
-	limitedReader := http.MaxBytesReader(nil, res.Body, 10*1024*1024) // 10MB max
-	doc, err := goquery.NewDocumentFromReader(limitedReader)
+	// PDFs and text files have no og tags; describe the document instead.
+	if kind != kindHTML {
+		document, err := readDocument(kind, body, res.Request.URL)
+		if err != nil {
+			logger.Warn("document parsing failed",
+				"event", "document_parse_failed",
+				"document_kind", kind,
+				"error", err,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+			return "", "", nil
+		}
+		ogDescription := document.description()
+		logger.Debug("document metadata extracted",
+			"event", "scrape_completed",
+			"document_kind", kind,
+			"title", document.Title,
+			"page_count", document.PageCount,
+			"description", ogDescription,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return "", ogDescription, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(body, 10*1024*1024)) // 10MB max
 	if err != nil {
 		logger.Error("html parsing failed",
 			"event", "html_parse_failed",
@@ -147,7 +175,7 @@ func getOGData(storyUrl string) (string, string, error) {
 	hasDescription := ogDescription != ""
 
 	if hasImage || hasDescription {
-		logger.Info("og data extracted successfully",
+		logger.Debug("og data extracted successfully",
 			"event", "scrape_completed",
 			"has_image", hasImage,
 			"has_description", hasDescription,
@@ -156,7 +184,7 @@ func getOGData(storyUrl string) (string, string, error) {
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
 	} else {
-		logger.Info("no og data found",
+		logger.Debug("no og data found",
 			"event", "scrape_completed",
 			"has_image", false,
 			"has_description", false,
@@ -200,7 +228,7 @@ func resolveURL(baseURL, relativeURL string, logger *slog.Logger) string {
 		return relativeURL
 	}
 
-	logger.Info("resolved relative url",
+	logger.Debug("resolved relative url",
 		"event", "url_resolved",
 		"original", relativeURL,
 		"resolved", resolved.String(),
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -21,7 +22,7 @@ func TestGetOGData(t *testing.T) {
 	}))
 	defer server.Close()
 
-	ogImage, ogDescription, err := getOGData(server.URL)
+	ogImage, ogDescription, err := getOGData(context.Background(), server.URL)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSearchHandler(t *testing.T) {
+	origStore := store
+	t.Cleanup(func() { store = origStore })
+	store = db.NewMemoryStore()
+
+	ctx := context.Background()
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 1; i <= 5; i++ {
+		story := types.Story{ID: i, Title: fmt.Sprintf("Rust release %d", i), Time: day.AddDate(0, 0, i-1).Unix()}
+		if err := store.UpsertStory(ctx, story); err != nil {
+			t.Fatalf("upsert story: %v", err)
+		}
+	}
+	if err := store.UpsertStory(ctx, types.Story{ID: 6, Title: "Unrelated", Time: day.Unix()}); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+
+	type response struct {
+		Page    int            `json:"page"`
+		Limit   int            `json:"limit"`
+		Total   int            `json:"total"`
+		Results []SearchResult `json:"results"`
+	}
+	get := func(query string) (*httptest.ResponseRecorder, response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		searchHandler(rec, httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil))
+		var resp response
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("%q: decoding response: %v", query, err)
+			}
+		}
+		return rec, resp
+	}
+
+	seen := make(map[int]bool)
+	for page, want := range []int{2, 2, 1} {
+		rec, resp := get(fmt.Sprintf("q=rust&limit=2&page=%d", page+1))
+		if rec.Code != http.StatusOK || resp.Total != 5 || resp.Page != page+1 || len(resp.Results) != want {
+			t.Fatalf("page %d: expected %d of 5 results, got %d %+v", page+1, want, rec.Code, resp)
+		}
+		for _, r := range resp.Results {
+			if seen[r.ID] {
+				t.Errorf("story %d appeared on more than one page", r.ID)
+			}
+			seen[r.ID] = true
+		}
+	}
+	if _, resp := get("q=rust&limit=2&page=4"); resp.Total != 5 || resp.Results == nil || len(resp.Results) != 0 {
+		t.Errorf("expected an empty page past the end, got %+v", resp)
+	}
+
+	if _, resp := get("q=rust"); resp.Limit != defaultSearchLimit || resp.Page != 1 {
+		t.Errorf("expected the default page and limit, got %+v", resp)
+	}
+	// Both bounds are inclusive days.
+	if _, resp := get("q=rust&from=2024-03-02&to=2024-03-03"); resp.Total != 2 {
+		t.Errorf("expected 2 stories submitted on 2024-03-02 and 2024-03-03, got %+v", resp)
+	}
+
+	for _, tt := range []struct {
+		query string
+		code  string
+	}{
+		{"q=+", "missing_query"},
+		{"q=rust&page=0", "invalid_page"},
+		{"q=rust&page=x", "invalid_page"},
+		{fmt.Sprintf("q=rust&limit=%d", maxSearchLimit+1), "invalid_limit"},
+		{"q=rust&from=yesterday", "invalid_date"},
+	} {
+		rec, _ := get(tt.query)
+		var resp ErrorResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusBadRequest || resp.Code != tt.code {
+			t.Errorf("%q: expected 400 %s, got %d %s", tt.query, tt.code, rec.Code, resp.Code)
+		}
+	}
+}
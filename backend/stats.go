@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/logging"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/abadojack/whatlanggo"
+)
+
+const (
+	// wordsPerMinute is a typical silent reading speed for non-fiction.
+	wordsPerMinute = 238
+
+	// charsPerWord converts Chinese, Japanese and Thai text, which is not
+	// split by spaces, into equivalent words.
+	charsPerWord = 2
+)
+
+// articleStatsOnRefreshFromEnv reads ARTICLE_STATS_ON_REFRESH, which makes
+// the refresher read every new story's article to compute its stats rather
+// than waiting for someone to ask for a summary.
+func articleStatsOnRefreshFromEnv() (bool, error) {
+	v := os.Getenv("ARTICLE_STATS_ON_REFRESH")
+	if v == "" {
+		return false, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("ARTICLE_STATS_ON_REFRESH must be true or false, got %q", v)
+	}
+	return on, nil
+}
+
+// articleStatsOnRefresh is set at startup.
+var articleStatsOnRefresh bool
+
+// computeArticleStats counts the words in text and detects its language.
+func computeArticleStats(text string) db.ArticleStats {
+	words := countWords(text)
+	if words == 0 {
+		return db.ArticleStats{}
+	}
+
+	stats := db.ArticleStats{
+		WordCount:          words,
+		ReadingTimeMinutes: max(1, (words+wordsPerMinute/2)/wordsPerMinute),
+	}
+	if info := whatlanggo.Detect(text); info.IsReliable() {
+		stats.Language = info.Lang.Iso6391()
+	}
+	return stats
+}
+
+// countWords counts space-separated words, and characters of scripts written
+// without spaces.
+func countWords(text string) int {
+	words, unspaced := 0, 0
+	for _, field := range strings.Fields(text) {
+		spaced := false
+		for _, r := range field {
+			if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai) {
+				unspaced++
+			} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				spaced = true
+			}
+		}
+		if spaced {
+			words++
+		}
+	}
+	return words + (unspaced+charsPerWord-1)/charsPerWord
+}
+
+// applyArticleStats copies stats onto the story.
+func (s *EnrichedStory) applyArticleStats(stats db.ArticleStats) {
+	s.WordCount = stats.WordCount
+	s.ReadingTimeMinutes = stats.ReadingTimeMinutes
+	s.Language = stats.Language
+}
+
+// readsExcerpt reports whether articleURL is read through a site extractor.
+// Their text, such as an arXiv abstract or a GitHub README, stands in for
+// the link in summaries but says nothing about how long it takes to read, so
+// those stories get no stats.
+func readsExcerpt(articleURL string) bool {
+	u, err := url.Parse(articleURL)
+	if err != nil {
+		return false
+	}
+	_, ok := findSiteExtractor(u)
+	return ok
+}
+
+// ensureArticleStats computes and saves the stats for story from its article
+// text, unless it already has them. A failed save is logged, not returned:
+// the stats are recomputed next time.
+func ensureArticleStats(ctx context.Context, story *EnrichedStory, text string) {
+	if story.WordCount > 0 || text == "" || readsExcerpt(story.URL) {
+		return
+	}
+	stats := computeArticleStats(text)
+	if stats.WordCount == 0 {
+		return
+	}
+	story.applyArticleStats(stats)
+
+	if err := store.SaveArticleStats(ctx, story.ID, stats); err != nil {
+		logging.FromContext(ctx).Error("article stats persist failed",
+			"event_type", "article_stats",
+			"event", "article_stats_persist_failed",
+			"story_id", story.ID,
+			"error", err,
+		)
+	}
+}
+
+// refreshArticleStats gives a newly seen story its stats, reading the
+// article unless they were saved on an earlier run or the story already
+// carries its text. The text is kept on the story so a summary does not
+// fetch it again. Links read through a site extractor get no stats.
+func refreshArticleStats(ctx context.Context, story *EnrichedStory) error {
+	if readsExcerpt(story.URL) {
+		return nil
+	}
+	if stored, err := store.GetStory(ctx, story.ID); err == nil && stored.Stats.WordCount > 0 {
+		story.applyArticleStats(stored.Stats)
+		return nil
+	}
+
+	text := story.ArticleText
+	if text == "" {
+		var err error
+		text, err = extractArticleText(ctx, story.URL)
+		if err != nil {
+			return err
+		}
+		story.ArticleText = text
+	}
+	ensureArticleStats(ctx, story, text)
+	return nil
+}
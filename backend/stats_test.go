@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestComputeArticleStats(t *testing.T) {
+	english := strings.Repeat("The quick brown fox jumps over the lazy dog while the farmer watches from the porch. ", 40)
+	stats := computeArticleStats(english)
+	if stats.WordCount != 640 || stats.ReadingTimeMinutes != 3 || stats.Language != "en" {
+		t.Errorf("english: %+v", stats)
+	}
+
+	german := "Die Bundesregierung hat am Mittwoch einen Gesetzentwurf beschlossen, der die Digitalisierung der Verwaltung beschleunigen soll. " +
+		"Bürgerinnen und Bürger sollen künftig die meisten Behördengänge online erledigen können."
+	if got := computeArticleStats(german).Language; got != "de" {
+		t.Errorf("german: language %q", got)
+	}
+
+	if got := countWords("日本語のテキスト and English — 42"); got != 4+3 {
+		t.Errorf("mixed scripts: %d words", got)
+	}
+
+	if got := computeArticleStats("Short."); got.ReadingTimeMinutes != 1 {
+		t.Errorf("short text: %+v", got)
+	}
+	if got := computeArticleStats("  \n "); got != (db.ArticleStats{}) {
+		t.Errorf("empty text: %+v", got)
+	}
+}
+
+func TestRefreshComputesArticleStats(t *testing.T) {
+	var articleHits atomic.Int32
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/topstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[1]`)
+	})
+	mux.HandleFunc("/item/1.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"title":"A long read","url":"%s/article.txt","score":50,"by":"pg","time":%d}`, server.URL, time.Now().Unix())
+	})
+	mux.HandleFunc("/article.txt", func(w http.ResponseWriter, r *http.Request) {
+		articleHits.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, strings.Repeat("Reading time is estimated from the number of words in the article. ", 100))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	origBaseURL, origDelay, origPush, origOnRefresh := hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() {
+		hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh = origBaseURL, origDelay, origPush, origOnRefresh
+		storyCache, store = origCache, origStore
+	})
+	hnBaseURL = server.URL
+	scrapeDelay = 0
+	pushNotification = func(ctx context.Context, s EnrichedStory) {}
+	articleStatsOnRefresh = true
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	refreshCache()
+
+	story, _ := storyCache.Get(1)
+	if story.WordCount != 1200 || story.ReadingTimeMinutes != 5 || story.Language != "en" {
+		t.Errorf("unexpected stats on the cached story: %+v", story)
+	}
+	if story.ArticleText == "" {
+		t.Error("expected the article text to be kept for summaries")
+	}
+	stored, err := store.GetStory(context.Background(), 1)
+	if err != nil || stored.Stats.WordCount != 1200 {
+		t.Errorf("expected persisted stats, got %+v, %v", stored.Stats, err)
+	}
+
+	// After a restart the stats come from the database: only the og data
+	// is fetched again.
+	storyCache = NewCache()
+	refreshCache()
+
+	if story, _ := storyCache.Get(1); story.WordCount != 1200 {
+		t.Errorf("expected stats restored from the database, got %+v", story)
+	}
+	if hits := articleHits.Load(); hits != 3 {
+		t.Errorf("expected 3 article fetches, got %d", hits)
+	}
+}
+
+func TestRefreshSkipsArticleStatsWhenOff(t *testing.T) {
+	var articleHits atomic.Int32
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/topstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[1]`)
+	})
+	mux.HandleFunc("/item/1.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id":1,"title":"A long read","url":"%s/article.txt","score":50,"by":"pg","time":%d}`, server.URL, time.Now().Unix())
+	})
+	mux.HandleFunc("/article.txt", func(w http.ResponseWriter, r *http.Request) {
+		articleHits.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, strings.Repeat("Reading time is estimated from the number of words in the article. ", 100))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	origBaseURL, origDelay, origPush, origOnRefresh := hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() {
+		hnBaseURL, scrapeDelay, pushNotification, articleStatsOnRefresh = origBaseURL, origDelay, origPush, origOnRefresh
+		storyCache, store = origCache, origStore
+	})
+	hnBaseURL = server.URL
+	scrapeDelay = 0
+	pushNotification = func(ctx context.Context, s EnrichedStory) {}
+	t.Setenv("ARTICLE_STATS_ON_REFRESH", "false")
+	var err error
+	if articleStatsOnRefresh, err = articleStatsOnRefreshFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	refreshCache()
+
+	if story, _ := storyCache.Get(1); story.WordCount != 0 || story.ArticleText != "" {
+		t.Errorf("expected no stats with ARTICLE_STATS_ON_REFRESH=false, got %+v", story)
+	}
+	// Only the og data is fetched.
+	if hits := articleHits.Load(); hits != 1 {
+		t.Errorf("expected 1 article fetch, got %d", hits)
+	}
+}
+
+func TestNoArticleStatsForExcerpts(t *testing.T) {
+	origStore := store
+	t.Cleanup(func() { store = origStore })
+	store = db.NewMemoryStore()
+
+	abstract := strings.Repeat("We propose a new network architecture based solely on attention mechanisms. ", 20)
+	paper := EnrichedStory{Story: types.Story{ID: 1, URL: "https://arxiv.org/abs/1706.03762"}}
+	ensureArticleStats(context.Background(), &paper, abstract)
+	if paper.WordCount != 0 || paper.ReadingTimeMinutes != 0 {
+		t.Errorf("expected no stats from an abstract, got %+v", paper)
+	}
+
+	// Nothing is fetched for them on refresh either.
+	repo := EnrichedStory{Story: types.Story{ID: 2, URL: "https://github.com/golang/go"}}
+	if err := refreshArticleStats(context.Background(), &repo); err != nil || repo.ArticleText != "" || repo.WordCount != 0 {
+		t.Errorf("expected the README to be left alone, got %+v, %v", repo, err)
+	}
+
+	post := EnrichedStory{Story: types.Story{ID: 3, URL: "https://example.com/post"}}
+	ensureArticleStats(context.Background(), &post, abstract)
+	if post.WordCount != 220 {
+		t.Errorf("expected stats for an ordinary page, got %+v", post)
+	}
+}
@@ -1,26 +1,40 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hn30/backend/logging"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"time"
 
-	"github.com/go-shiori/go-readability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var summarizerClient = &http.Client{
 	Timeout: 10 * time.Second,
 }
 
+// llmClient has no overall timeout; each attempt is bounded by LLM_TIMEOUT.
+var llmClient = &http.Client{}
+
 type OpenRouterRequest struct {
-	Model    string              `json:"model"`
-	Messages []OpenRouterMessage `json:"messages"`
+	Model    string                  `json:"model"`
+	Messages []OpenRouterMessage     `json:"messages"`
+	Usage    *OpenRouterUsageOptions `json:"usage,omitempty"`
+}
+
+// OpenRouterUsageOptions asks OpenRouter to include the cost of the request
+// in the usage block of the response.
+type OpenRouterUsageOptions struct {
+	Include bool `json:"include"`
 }
 
 type OpenRouterResponse struct {
@@ -28,7 +42,15 @@ type OpenRouterResponse struct {
 	Choices []struct {
 		Message OpenRouterMessage `json:"message"`
 	} `json:"choices"`
-	Model string `json:"model"`
+	Model string          `json:"model"`
+	Usage OpenRouterUsage `json:"usage"`
+}
+
+type OpenRouterUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"` // in USD
 }
 
 type OpenRouterMessage struct {
@@ -36,55 +58,228 @@ type OpenRouterMessage struct {
 	Content string `json:"content"`
 }
 
+// SummaryResponse is a generated summary. Model is the model that actually
+// wrote it, which may be a fallback rather than the first in the chain.
 type SummaryResponse struct {
-	Summary string `json:"summary"`
-	Model   string `json:"model"`
+	Summary  string          `json:"summary"`
+	Model    string          `json:"model"`
+	Provider string          `json:"-"`
+	Usage    OpenRouterUsage `json:"-"`
 }
 
-func generateSummary(articleText string) (SummaryResponse, error) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+// providerError is a failed summary attempt. Message is safe to show to
+// users; Retryable marks failures another provider may not share: timeouts,
+// network errors, 429s, 5xx responses and unusable response bodies.
+type providerError struct {
+	Message   string
+	Status    int
+	Retryable bool
+	Err       error
+}
+
+func (e *providerError) Error() string { return e.Message }
+
+func (e *providerError) Unwrap() error { return e.Err }
+
+// generateSummary asks each provider in the chain in turn until one
+// produces a summary. Providers whose circuit breaker is open are skipped;
+// failures that are our fault, such as a rejected request, stop the chain
+// since every provider would reject it too.
+func generateSummary(ctx context.Context, prompt renderedPrompt) (SummaryResponse, error) {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "ai_operation",
 		"operation", "generate_summary",
-		"provider", "openrouter",
+		"prompt_version", prompt.Version,
 	)
 	start := time.Now()
 
-	if articleText == "" {
-		logger.Error("article text missing",
-			"event", "validation_failed",
-			"error", "no article text provided",
+	lastErr := &providerError{Message: "AI Provider could not generate summary."}
+	for attempt, c := range llm.Chain {
+		attemptLogger := logger.With(
+			"provider", c.Provider.Name,
+			"model", c.Model,
+			"attempt", attempt+1,
+		)
+
+		if !c.Provider.breaker.Allow() {
+			llmRequests.WithLabelValues(opGenerateSummary, c.Provider.Name, "skipped").Inc()
+			attemptLogger.Warn("provider circuit open, skipping",
+				"event", "provider_skipped",
+			)
+			continue
+		}
+
+		attemptCtx, span := tracer.Start(ctx, "llm.attempt", trace.WithAttributes(
+			attribute.String("gen_ai.system", c.Provider.Name),
+			attribute.String("gen_ai.request.model", c.Model),
+			attribute.Int("llm.attempt", attempt+1),
+		))
+		summary, err := requestCompletion(attemptCtx, c, opGenerateSummary, prompt)
+		endSpan(span, err)
+
+		if err == nil {
+			c.Provider.breaker.Success()
+			llmRequests.WithLabelValues(opGenerateSummary, c.Provider.Name, "success").Inc()
+			summaryDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+			summaryTokens.WithLabelValues("prompt").Add(float64(summary.Usage.PromptTokens))
+			summaryTokens.WithLabelValues("completion").Add(float64(summary.Usage.CompletionTokens))
+			summaryCost.Add(summary.Usage.Cost)
+
+			attemptLogger.Info("summary generated successfully",
+				"event", "summary_generation_completed",
+				"model_used", summary.Model,
+				"summary_length", len(summary.Summary),
+				"prompt_tokens", summary.Usage.PromptTokens,
+				"completion_tokens", summary.Usage.CompletionTokens,
+				"cost_usd", summary.Usage.Cost,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+			return summary, nil
+		}
+
+		llmRequests.WithLabelValues(opGenerateSummary, c.Provider.Name, "failure").Inc()
+		if !errors.As(err, &lastErr) {
+			lastErr = &providerError{Message: "AI Provider could not generate summary.", Err: err}
+		}
+		if lastErr.Retryable {
+			c.Provider.breaker.Failure()
+		} else {
+			// The provider answered, so it is up; the request was the
+			// problem.
+			c.Provider.breaker.Success()
+		}
+
+		attemptLogger.Warn("provider attempt failed",
+			"event", "provider_attempt_failed",
+			"error", lastErr.Err,
+			"status_code", lastErr.Status,
+			"retryable", lastErr.Retryable,
+			"breaker_state", c.Provider.breaker.State().String(),
 		)
-		return SummaryResponse{}, fmt.Errorf("Either no article text was provided for summarization or it could not be parsed.")
+		if !lastErr.Retryable {
+			break
+		}
 	}
 
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	if apiKey == "" {
+	summaryDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
+	logger.Error("all providers failed",
+		"event", "summary_generation_failed",
+		"error", lastErr.Err,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return SummaryResponse{}, lastErr
+}
+
+// generateCompletion runs a chat completion on the summary chain for
+// something other than a summary, such as topic classification. Providers
+// are skipped while their circuit breaker is cooling down, but unlike
+// generateSummary it neither probes nor trips the breakers and stays out of the summary
+// metrics, so background work cannot take summaries down with it.
+func generateCompletion(ctx context.Context, operation string, prompt renderedPrompt) (SummaryResponse, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "ai_operation",
+		"operation", operation,
+		"prompt_version", prompt.Version,
+	)
+	start := time.Now()
+
+	var lastErr error = errors.New("no provider available")
+	for attempt, c := range llm.Chain {
+		if c.Provider.breaker.Open() {
+			llmRequests.WithLabelValues(operation, c.Provider.Name, "skipped").Inc()
+			continue
+		}
+
+		attemptCtx, span := tracer.Start(ctx, "llm.attempt", trace.WithAttributes(
+			attribute.String("gen_ai.system", c.Provider.Name),
+			attribute.String("gen_ai.request.model", c.Model),
+			attribute.Int("llm.attempt", attempt+1),
+		))
+		resp, err := requestCompletion(attemptCtx, c, operation, prompt)
+		endSpan(span, err)
+
+		if err == nil {
+			llmRequests.WithLabelValues(operation, c.Provider.Name, "success").Inc()
+			logger.Debug("completion generated",
+				"event", "completion_completed",
+				"provider", c.Provider.Name,
+				"model_used", resp.Model,
+				"prompt_tokens", resp.Usage.PromptTokens,
+				"completion_tokens", resp.Usage.CompletionTokens,
+				"cost_usd", resp.Usage.Cost,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+			return resp, nil
+		}
+
+		llmRequests.WithLabelValues(operation, c.Provider.Name, "failure").Inc()
+		lastErr = err
+		var perr *providerError
+		if errors.As(err, &perr) {
+			// The message is meant for summary users; the cause is what
+			// the caller logs.
+			lastErr = perr.Err
+			if !perr.Retryable {
+				break
+			}
+		}
+	}
+	return SummaryResponse{}, lastErr
+}
+
+// requestCompletion makes one chat completion call to c. operation names
+// what it is for in logs.
+func requestCompletion(ctx context.Context, c llmCandidate, operation string, prompt renderedPrompt) (SummaryResponse, error) {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "ai_operation",
+		"operation", operation,
+		"provider", c.Provider.Name,
+		"model", c.Model,
+	)
+	start := time.Now()
+
+	apiKey := os.Getenv(c.Provider.KeyEnv)
+	if apiKey == "" && c.Provider.isBuiltin() {
 		logger.Error("api key missing",
 			"event", "configuration_error",
-			"error", "OPENROUTER_API_KEY not set",
+			"error", c.Provider.KeyEnv+" not set",
 		)
-		panic("Please set OPENROUTER_API_KEY")
+		return SummaryResponse{}, &providerError{
+			Message:   "AI Provider could not generate summary.",
+			Retryable: true,
+			Err:       fmt.Errorf("%s not set", c.Provider.KeyEnv),
+		}
 	}
 
-	logger.Info("generating ai summary",
-		"event", "summary_generation_started",
-		"article_length", len(articleText),
-		"model", "@preset/hn30-summary",
+	ctx, cancel := context.WithTimeout(ctx, llm.Timeout)
+	defer cancel()
+
+	logger.Info("requesting completion",
+		"event", "completion_started",
+		"system_prompt_length", len(prompt.System),
+		"user_prompt_length", len(prompt.User),
 	)
 
 	body := OpenRouterRequest{
-		Model: "@preset/hn30-summary",
+		Model: c.Model,
 		Messages: []OpenRouterMessage{
+			{
+				Role:    "system",
+				Content: prompt.System,
+			},
 			{
 				Role:    "user",
-				Content: articleText,
+				Content: prompt.User,
 			},
 		},
 	}
+	if c.Provider.isOpenRouter() {
+		body.Usage = &OpenRouterUsageOptions{Include: true}
+	}
 
 	jsonBody, _ := json.Marshal(body)
 
-	req, err := http.NewRequest("POST", "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Provider.BaseURL+"/chat/completions", bytes.NewBuffer(jsonBody))
 
 	if err != nil {
 		logger.Error("request creation failed",
@@ -92,33 +287,36 @@ func generateSummary(articleText string) (SummaryResponse, error) {
 			"error", err,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return SummaryResponse{}, fmt.Errorf("AI Provider could not generate summary.")
+		return SummaryResponse{}, &providerError{Message: "AI Provider could not generate summary.", Err: err}
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("HTTP-Referer", "https://hn30.yamanlabs.com")
-	req.Header.Set("X-Title", "hn30")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if c.Provider.isOpenRouter() {
+		req.Header.Set("HTTP-Referer", "https://hn30.yamanlabs.com")
+		req.Header.Set("X-Title", "hn30")
+	}
 
-	logger.Info("sending request to openrouter",
+	logger.Info("sending request to provider",
 		"event", "api_request_started",
 		"request_size", len(jsonBody),
 	)
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+	res, err := llmClient.Do(req)
 
 	if err != nil {
-		logger.Error("openrouter request failed",
+		logger.Error("provider request failed",
 			"event", "api_request_failed",
 			"error", err,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return SummaryResponse{}, fmt.Errorf("AI Provider could not generate summary.")
+		return SummaryResponse{}, &providerError{Message: "AI Provider could not generate summary.", Retryable: true, Err: err}
 	}
 	defer res.Body.Close()
 
-	logger.Info("response received from openrouter",
+	logger.Info("response received from provider",
 		"event", "api_response_received",
 		"status_code", res.StatusCode,
 		"content_length", res.ContentLength,
@@ -126,13 +324,18 @@ func generateSummary(articleText string) (SummaryResponse, error) {
 
 	if res.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(res.Body)
-		logger.Error("openrouter returned error",
+		logger.Error("provider returned error",
 			"event", "api_error_response",
 			"status_code", res.StatusCode,
 			"response_body", string(bodyBytes),
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return SummaryResponse{}, fmt.Errorf("AI Provider could not generate summary.")
+		return SummaryResponse{}, &providerError{
+			Message:   "AI Provider could not generate summary.",
+			Status:    res.StatusCode,
+			Retryable: res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+			Err:       fmt.Errorf("%s returned status %d", c.Provider.Name, res.StatusCode),
+		}
 	}
 
 	var openRouterResp OpenRouterResponse
@@ -142,7 +345,7 @@ func generateSummary(articleText string) (SummaryResponse, error) {
 			"error", err,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return SummaryResponse{}, fmt.Errorf("Could not read AI Provider response.")
+		return SummaryResponse{}, &providerError{Message: "Could not read AI Provider response.", Retryable: true, Err: err}
 	}
 
 	if len(openRouterResp.Choices) == 0 {
@@ -151,24 +354,41 @@ func generateSummary(articleText string) (SummaryResponse, error) {
 			"response_id", openRouterResp.ID,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return SummaryResponse{}, fmt.Errorf("No summary generated by AI Provider.")
+		return SummaryResponse{}, &providerError{
+			Message:   "No summary generated by AI Provider.",
+			Retryable: true,
+			Err:       fmt.Errorf("%s returned no choices", c.Provider.Name),
+		}
 	}
 
-	summary := openRouterResp.Choices[0].Message.Content
+	model := openRouterResp.Model
+	if model == "" {
+		model = c.Model
+	}
 
-	logger.Info("summary generated successfully",
-		"event", "summary_generation_completed",
+	logger.Debug("provider response decoded",
+		"event", "api_response_decoded",
 		"response_id", openRouterResp.ID,
-		"model_used", openRouterResp.Model,
-		"summary_length", len(summary),
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 
-	return SummaryResponse{Summary: summary, Model: openRouterResp.Model}, nil
+	// Only OpenRouter reports what a request cost; for the others it is
+	// estimated from the configured price.
+	usage := openRouterResp.Usage
+	if usage.Cost == 0 && c.Price != nil {
+		usage.Cost = c.Price.cost(usage)
+	}
+
+	return SummaryResponse{
+		Summary:  openRouterResp.Choices[0].Message.Content,
+		Model:    model,
+		Provider: c.Provider.Name,
+		Usage:    usage,
+	}, nil
 }
 
-func extractArticleText(articleURL string) (string, error) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+func extractArticleText(ctx context.Context, articleURL string) (string, error) {
+	logger := logging.FromContext(ctx).With(
 		"event_type", "article_extraction",
 		"operation", "extract_text",
 		"url", articleURL,
@@ -179,8 +399,32 @@ func extractArticleText(articleURL string) (string, error) {
 		"event", "extraction_started",
 	)
 
+	// Some sites are better read through their own APIs. If that fails the
+	// page is still read like any other.
+	if u, err := url.Parse(articleURL); err == nil {
+		if extractor, ok := findSiteExtractor(u); ok {
+			doc, err := extractor.Extract(ctx, u)
+			if err == nil {
+				logger.Info("article text extracted successfully",
+					"event", "extraction_completed",
+					"extractor", extractor.Name,
+					"document_kind", doc.Kind,
+					"article_title", doc.Title,
+					"text_length", len(doc.Text),
+					"duration_ms", time.Since(start).Milliseconds(),
+				)
+				return doc.Text, nil
+			}
+			logger.Warn("site extractor failed, falling back to the page",
+				"event", "site_extractor_failed",
+				"extractor", extractor.Name,
+				"error", err,
+			)
+		}
+	}
+
 	// Create a new request so we can set headers
-	req, err := http.NewRequest("GET", articleURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", articleURL, nil)
 	if err != nil {
 		logger.Error("request creation failed",
 			"event", "request_creation_failed",
@@ -221,20 +465,23 @@ func extractArticleText(articleURL string) (string, error) {
 		return "", fmt.Errorf("failed to fetch URL: status %d", resp.StatusCode)
 	}
 
-	parsedURL, err := url.Parse(articleURL)
-	if err != nil {
-		logger.Error("url parsing failed",
-			"event", "url_parse_failed",
-			"error", err,
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	kind := documentKind(resp.Header.Get("Content-Type"), resp.Request.URL, head)
+	if kind == "" {
+		logger.Warn("unsupported content type",
+			"event", "content_type_unsupported",
+			"content_type", resp.Header.Get("Content-Type"),
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
-		return "", fmt.Errorf("invalid URL: %v", err)
+		return "", fmt.Errorf("%w: %s", errUnsupportedDocument, resp.Header.Get("Content-Type"))
 	}
 
-	article, err := readability.FromReader(resp.Body, parsedURL)
+	doc, err := readDocument(kind, body, resp.Request.URL)
 	if err != nil {
-		logger.Error("readability parsing failed",
-			"event", "readability_failed",
+		logger.Error("document parsing failed",
+			"event", "document_parse_failed",
+			"document_kind", kind,
 			"error", err,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
@@ -243,10 +490,12 @@ func extractArticleText(articleURL string) (string, error) {
 
 	logger.Info("article text extracted successfully",
 		"event", "extraction_completed",
-		"article_title", article.Title,
-		"text_length", len(article.TextContent),
+		"document_kind", doc.Kind,
+		"article_title", doc.Title,
+		"page_count", doc.PageCount,
+		"text_length", len(doc.Text),
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 
-	return article.TextContent, nil
+	return doc.Text, nil
 }
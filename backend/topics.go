@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hn30/backend/logging"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// topic is a tag stories can carry. Keywords are matched as whole words in
+// the title and description, ignoring case and punctuation; domains match
+// the link's host and its subdomains.
+type topic struct {
+	Tag      string
+	Keywords []string
+	Domains  []string
+}
+
+// topics is the fixed set of tags, for both classifiers. Keywords stay clear
+// of everyday words ("go", "swift", "arm") that would tag half the front
+// page.
+var topics = []topic{
+	{
+		Tag: "ai",
+		Keywords: []string{"ai", "llm", "llms", "gpt", "chatgpt", "openai", "anthropic", "claude", "gemini", "mistral", "llama",
+			"machine learning", "deep learning", "neural network", "neural networks", "transformer", "transformers",
+			"diffusion", "embeddings", "inference", "fine-tuning", "agi", "copilot"},
+		Domains: []string{"openai.com", "anthropic.com", "huggingface.co", "deepmind.google", "deepmind.com"},
+	},
+	{
+		Tag: "security",
+		Keywords: []string{"security", "vulnerability", "vulnerabilities", "exploit", "exploits", "cve", "malware", "ransomware",
+			"breach", "hacked", "backdoor", "phishing", "zero-day", "encryption", "spyware", "infosec", "pentest"},
+		Domains: []string{"krebsonsecurity.com", "bleepingcomputer.com", "schneier.com", "thehackernews.com"},
+	},
+	{
+		Tag: "programming",
+		Keywords: []string{"programming", "programmer", "programmers", "compiler", "compilers", "golang", "rust", "python",
+			"javascript", "typescript", "haskell", "c++", "zig", "kotlin", "elixir", "erlang", "ocaml", "lisp", "clojure",
+			"java", "webassembly", "wasm", "sql", "postgres", "postgresql", "sqlite", "git", "refactoring", "type system"},
+		Domains: []string{"go.dev", "rust-lang.org", "python.org", "stackoverflow.com"},
+	},
+	{
+		Tag: "startups",
+		Keywords: []string{"startup", "startups", "founder", "founders", "y combinator", "yc", "vc", "venture capital",
+			"series a", "series b", "seed round", "fundraising", "raises", "ipo", "acquires", "acquisition", "valuation", "launch hn"},
+		Domains: []string{"techcrunch.com", "paulgraham.com"},
+	},
+	{
+		Tag: "hardware",
+		Keywords: []string{"cpu", "cpus", "gpu", "gpus", "chip", "chips", "semiconductor", "semiconductors", "risc-v", "fpga",
+			"silicon", "nvidia", "intel", "amd", "tsmc", "raspberry pi", "arduino", "pcb", "transistor", "transistors", "microcontroller"},
+		Domains: []string{"anandtech.com", "tomshardware.com", "hackaday.com", "servethehome.com"},
+	},
+	{
+		Tag: "science",
+		Keywords: []string{"physics", "physicists", "biology", "chemistry", "astronomy", "astronomers", "quantum", "researchers",
+			"scientists", "climate", "genome", "neuroscience", "mathematics", "mathematician", "evolution", "telescope", "nasa"},
+		Domains: []string{"nature.com", "science.org", "arxiv.org", "quantamagazine.org", "phys.org", "nasa.gov"},
+	},
+}
+
+// Topic classifiers, chosen with TOPIC_CLASSIFIER.
+const (
+	classifierHeuristic = "heuristic"
+	classifierLLM       = "llm"
+	classifierOff       = "off"
+)
+
+// topicClassifierFromEnv reads TOPIC_CLASSIFIER: "heuristic" (the default)
+// matches keywords and domains, "llm" asks the configured LLM providers and
+// falls back to the heuristics when they fail, "off" tags nothing.
+func topicClassifierFromEnv() (string, error) {
+	switch v := os.Getenv("TOPIC_CLASSIFIER"); v {
+	case "":
+		return classifierHeuristic, nil
+	case classifierHeuristic, classifierLLM, classifierOff:
+		return v, nil
+	default:
+		return "", fmt.Errorf("TOPIC_CLASSIFIER must be heuristic, llm or off, got %q", v)
+	}
+}
+
+// topicClassifyTimeout bounds an LLM classification, across the whole
+// chain, so a slow provider cannot hold up a refresh for long. The
+// heuristics take over when it runs out.
+const topicClassifyTimeout = 15 * time.Second
+
+// topicClassifier is set at startup.
+var topicClassifier = classifierHeuristic
+
+func isTopic(tag string) bool {
+	return slices.ContainsFunc(topics, func(t topic) bool { return t.Tag == tag })
+}
+
+func topicTags() []string {
+	tags := make([]string, len(topics))
+	for i, t := range topics {
+		tags[i] = t.Tag
+	}
+	return tags
+}
+
+// normalizeWords lowercases s and turns everything but letters, digits, "+"
+// and "#" into single spaces, padded so " word " finds whole words.
+func normalizeWords(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
+
+// classifyHeuristic tags a story from its title, description and domain.
+func classifyHeuristic(story EnrichedStory) []string {
+	text := normalizeWords(story.Title + " " + story.OGDescription)
+	host := ""
+	if u, err := url.Parse(story.URL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+
+	var tags []string
+	for _, t := range topics {
+		matched := slices.ContainsFunc(t.Domains, func(d string) bool {
+			return host == d || strings.HasSuffix(host, "."+d)
+		})
+		if !matched {
+			matched = slices.ContainsFunc(t.Keywords, func(k string) bool {
+				return strings.Contains(text, normalizeWords(k))
+			})
+		}
+		if matched {
+			tags = append(tags, t.Tag)
+		}
+	}
+	return tags
+}
+
+// topicPrompt asks for tags from the fixed list only, so the reply can be
+// checked against it.
+func topicPrompt(story EnrichedStory) renderedPrompt {
+	domain := ""
+	if u, err := url.Parse(story.URL); err == nil {
+		domain = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	return renderedPrompt{
+		Version: "topics",
+		System: "You classify Hacker News stories by topic. The topics are: " + strings.Join(topicTags(), ", ") + ". " +
+			"Reply with the topics that clearly apply, separated by commas, using only names from that list. " +
+			"Reply with \"none\" if no topic applies. Do not explain.",
+		User: fmt.Sprintf("Title: %s\nSource: %s\nDescription: %s", story.Title, domain, story.OGDescription),
+	}
+}
+
+// parseTopicReply keeps the known tags in an LLM reply, in topic order.
+func parseTopicReply(reply string) []string {
+	words := strings.FieldsFunc(strings.ToLower(reply), func(r rune) bool {
+		return r == ',' || r == '\n' || r == ' ' || r == '.' || r == '"' || r == '\''
+	})
+	var tags []string
+	for _, t := range topics {
+		if slices.Contains(words, t.Tag) {
+			tags = append(tags, t.Tag)
+		}
+	}
+	return tags
+}
+
+// classifyLLM asks the LLM providers for tags. It gives up, leaving the
+// heuristics to the caller, when the budget is used up.
+func classifyLLM(ctx context.Context, story EnrichedStory) ([]string, error) {
+	if llmBudget.DailyUSD > 0 || llmBudget.MonthlyUSD > 0 {
+		status, err := checkBudget(ctx, store, llmBudget, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if status.Exceeded {
+			return nil, fmt.Errorf("%s llm budget exceeded", status.Period)
+		}
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, topicClassifyTimeout)
+	defer cancel()
+
+	resp, err := generateCompletion(reqCtx, opClassifyTopics, topicPrompt(story))
+	if err != nil {
+		return nil, err
+	}
+	recordUsage(ctx, story.ID, opClassifyTopics, resp)
+	return parseTopicReply(resp.Summary), nil
+}
+
+// classifyStory tags a newly seen story and saves the tags. With the LLM
+// classifier, tags saved on an earlier run are reused rather than paid for
+// again.
+func classifyStory(ctx context.Context, story *EnrichedStory) error {
+	logger := logging.FromContext(ctx).With(
+		"event_type", "topic_classification",
+		"story_id", story.ID,
+		"classifier", topicClassifier,
+	)
+	start := time.Now()
+
+	var tags []string
+	switch topicClassifier {
+	case classifierOff:
+		return nil
+	case classifierLLM:
+		if stored, err := store.GetStory(ctx, story.ID); err == nil && len(stored.Tags) > 0 {
+			story.Tags = stored.Tags
+			return nil
+		}
+		var err error
+		tags, err = classifyLLM(ctx, *story)
+		if err != nil {
+			logger.Warn("llm classification failed, using heuristics",
+				"event", "topic_llm_failed",
+				"error", err,
+			)
+			tags = classifyHeuristic(*story)
+		}
+	default:
+		tags = classifyHeuristic(*story)
+	}
+
+	story.Tags = tags
+	logger.Debug("story classified",
+		"event", "topic_classified",
+		"tags", tags,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return store.SetStoryTags(ctx, story.ID, tags)
+}
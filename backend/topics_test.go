@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hn30/backend/db"
+	"hn30/backend/types"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClassifyHeuristic(t *testing.T) {
+	tests := []struct {
+		title       string
+		url         string
+		description string
+		want        []string
+	}{
+		{"Show HN: A C++ compiler written in Rust", "https://github.com/x/y", "", []string{"programming"}},
+		{"Critical zero-day in OpenSSH exploited in the wild", "https://example.com/a", "", []string{"security"}},
+		{"Running LLMs locally on a Raspberry Pi", "https://example.com/b", "", []string{"ai", "hardware"}},
+		{"Why I moved to the countryside", "https://blog.example.com/c", "", nil},
+		{"A new kind of crystal", "https://www.quantamagazine.org/d", "", []string{"science"}},
+		{"Acme (YC W24) is hiring", "https://example.com/jobs", "", []string{"startups"}},
+		{"Notes from the trip", "https://example.com/e", "We pointed the telescope at Jupiter.", []string{"science"}},
+		// Everyday words that name languages elsewhere are not enough.
+		{"Let's go for a swift walk", "https://example.com/f", "", nil},
+	}
+	for _, tt := range tests {
+		story := EnrichedStory{Story: types.Story{Title: tt.title, URL: tt.url}, OGDescription: tt.description}
+		if got := classifyHeuristic(story); !slices.Equal(got, tt.want) {
+			t.Errorf("classifyHeuristic(%q) = %v, want %v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestParseTopicReply(t *testing.T) {
+	if got := parseTopicReply("Security, AI.\n"); !slices.Equal(got, []string{"ai", "security"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := parseTopicReply("none"); got != nil {
+		t.Errorf("expected no tags, got %v", got)
+	}
+	if got := parseTopicReply("ai, cooking"); !slices.Equal(got, []string{"ai"}) {
+		t.Errorf("expected unknown topics to be dropped, got %v", got)
+	}
+}
+
+func TestClassifyStoryLLM(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":   "tagger",
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "hardware, science"}}},
+			"usage":   map[string]any{"prompt_tokens": 40, "completion_tokens": 3},
+		})
+	}))
+	defer srv.Close()
+	useLLMChain(t, "local:tagger", map[string]string{"LLM_PROVIDER_LOCAL_BASE_URL": srv.URL})
+
+	origStore, origClassifier := store, topicClassifier
+	t.Cleanup(func() { store, topicClassifier = origStore, origClassifier })
+	store = db.NewMemoryStore()
+	topicClassifier = classifierLLM
+
+	story := EnrichedStory{Story: types.Story{ID: 5, Title: "Measuring gravity with a homemade pendulum", URL: "https://example.com"}}
+	if err := store.UpsertStory(context.Background(), story.Story); err != nil {
+		t.Fatalf("upsert story: %v", err)
+	}
+	if err := classifyStory(context.Background(), &story); err != nil {
+		t.Fatalf("classifyStory: %v", err)
+	}
+	if !slices.Equal(story.Tags, []string{"hardware", "science"}) {
+		t.Errorf("tags = %v", story.Tags)
+	}
+
+	// After a restart the saved tags are reused instead of asking again.
+	again := EnrichedStory{Story: story.Story}
+	if err := classifyStory(context.Background(), &again); err != nil {
+		t.Fatalf("classifyStory: %v", err)
+	}
+	if calls != 1 || !slices.Equal(again.Tags, story.Tags) {
+		t.Errorf("expected stored tags without a second call, got %v after %d calls", again.Tags, calls)
+	}
+}
+
+func TestClassifyLLMKeepsToItself(t *testing.T) {
+	down, downCalls := fakeProvider(t, http.StatusServiceUnavailable, "")
+	up, _ := fakeProvider(t, http.StatusOK, "ai")
+	useLLMChain(t, "tagsdown:m,tagsup:ai", map[string]string{
+		"LLM_PROVIDER_TAGSDOWN_BASE_URL": down.URL,
+		"LLM_PROVIDER_TAGSUP_BASE_URL":   up.URL,
+	})
+	origStore := store
+	t.Cleanup(func() { store = origStore })
+	store = db.NewMemoryStore()
+
+	story := EnrichedStory{Story: types.Story{ID: 9, Title: "Something"}}
+	for range llmBreakerThreshold + 1 {
+		tags, err := classifyLLM(context.Background(), story)
+		if err != nil || !slices.Equal(tags, []string{"ai"}) {
+			t.Fatalf("expected the fallback to tag the story, got %v, %v", tags, err)
+		}
+	}
+
+	// Failures while tagging say nothing about whether summaries work.
+	if state := llm.Chain[0].Provider.breaker.State(); state != breakerClosed {
+		t.Errorf("expected the breaker to stay closed, got %s", state)
+	}
+	if got := int(downCalls.Load()); got != llmBreakerThreshold+1 {
+		t.Errorf("expected every classification to try the first provider, got %d calls", got)
+	}
+	if got := testutil.ToFloat64(llmRequests.WithLabelValues(opClassifyTopics, "tagsdown", "failure")); got != llmBreakerThreshold+1 {
+		t.Errorf("classify_topics failures = %v", got)
+	}
+	if got := testutil.ToFloat64(llmRequests.WithLabelValues(opGenerateSummary, "tagsup", "success")); got != 0 {
+		t.Errorf("expected no summary requests, got %v", got)
+	}
+
+	days, err := store.UsageByDay(context.Background(), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("usage by day: %v", err)
+	}
+	if len(days) != 1 || days[0].Operation != opClassifyTopics || days[0].Requests != llmBreakerThreshold+1 {
+		t.Errorf("expected the usage to be recorded as topic classification, got %+v", days)
+	}
+}
+
+func TestClassifyLLMTriesProviderAfterCooldown(t *testing.T) {
+	up, calls := fakeProvider(t, http.StatusOK, "ai")
+	useLLMChain(t, "recovered:ai", map[string]string{"LLM_PROVIDER_RECOVERED_BASE_URL": up.URL})
+	origStore := store
+	t.Cleanup(func() { store = origStore })
+	store = db.NewMemoryStore()
+
+	now := time.Now()
+	b := llm.Chain[0].Provider.breaker
+	b.now = func() time.Time { return now }
+	for range llmBreakerThreshold {
+		b.Failure()
+	}
+
+	story := EnrichedStory{Story: types.Story{ID: 10, Title: "Something"}}
+	if _, err := classifyLLM(context.Background(), story); err == nil || calls.Load() != 0 {
+		t.Fatalf("expected the provider to be skipped while cooling down, got %v after %d calls", err, calls.Load())
+	}
+
+	// No summary has probed the provider since, but classification still
+	// goes back to it.
+	now = now.Add(llmBreakerCooldown)
+	if tags, err := classifyLLM(context.Background(), story); err != nil || !slices.Equal(tags, []string{"ai"}) {
+		t.Errorf("expected the provider to be asked after the cooldown, got %v, %v", tags, err)
+	}
+}
+
+func TestTopStoriesTagFilter(t *testing.T) {
+	origCache := storyCache
+	t.Cleanup(func() { storyCache = origCache })
+	storyCache = NewCache()
+	for _, s := range []EnrichedStory{
+		{Story: types.Story{ID: 1, Title: "One"}, Tags: []string{"ai"}},
+		{Story: types.Story{ID: 2, Title: "Two"}, Tags: []string{"security"}},
+		{Story: types.Story{ID: 3, Title: "Three"}},
+	} {
+		storyCache.Set(s.ID, s)
+	}
+	storyCache.SetStoryIDs([]int{1, 2, 3})
+
+	rec := httptest.NewRecorder()
+	topStoriesHandler(rec, httptest.NewRequest("GET", "/api/top?tag=security", nil))
+	var stories []EnrichedStory
+	if err := json.NewDecoder(rec.Body).Decode(&stories); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(stories) != 1 || stories[0].ID != 2 {
+		t.Errorf("expected only story 2, got %+v", stories)
+	}
+
+	rec = httptest.NewRecorder()
+	topStoriesHandler(rec, httptest.NewRequest("GET", "/api/top?tag=hardware", nil))
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("expected an empty list, got %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	topStoriesHandler(rec, httptest.NewRequest("GET", "/api/top?tag=cooking", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown tag, got %d", rec.Code)
+	}
+}
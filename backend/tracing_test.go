@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"hn30/backend/db"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRefreshCacheSpans(t *testing.T) {
+	var articleHits atomic.Int32
+	server := newFakeHN(t, &articleHits)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	origProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+
+	origBaseURL, origDelay, origPush := hnBaseURL, scrapeDelay, pushNotification
+	origCache, origStore := storyCache, store
+	t.Cleanup(func() {
+		otel.SetTracerProvider(origProvider)
+		hnBaseURL, scrapeDelay, pushNotification = origBaseURL, origDelay, origPush
+		storyCache, store = origCache, origStore
+	})
+
+	notified := make(chan struct{}, 10)
+	hnBaseURL = server.URL
+	scrapeDelay = 0
+	pushNotification = func(ctx context.Context, s EnrichedStory) { notified <- struct{}{} }
+	storyCache = NewCache()
+	store = db.NewMemoryStore()
+
+	refreshCache()
+	<-notified
+	provider.ForceFlush(context.Background())
+
+	spans := recorder.Ended()
+	byName := make(map[string]int)
+	var root sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		byName[s.Name()]++
+		if s.Name() == "refresh_cache" {
+			root = s
+		}
+	}
+	if root == nil {
+		t.Fatalf("expected a refresh_cache span, got %v", byName)
+	}
+
+	for name, want := range map[string]int{
+		"hn.get_top_story_ids": 1,
+		"process_story":        2,
+		"hn.get_story_details": 2,
+		"scrape.og_data":       2,
+		"db.persist_story":     2,
+	} {
+		if byName[name] != want {
+			t.Errorf("expected %d %s spans, got %d", want, name, byName[name])
+		}
+	}
+
+	for _, s := range spans {
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is not part of the refresh trace", s.Name())
+		}
+	}
+}
@@ -12,7 +12,14 @@ export async function getSummary(storyId) {
   if (res.ok) {
     return await res.json();
   } else {
-    const errorText = await res.text();
-    throw new Error(`An error occurred: ${errorText}`);
+    // Errors use the backend's envelope: { code, message, request_id, retry_after }.
+    let message = res.statusText;
+    try {
+      const body = await res.json();
+      message = body.message ?? message;
+    } catch {
+      // Not JSON, e.g. an error page from a proxy in front of the backend.
+    }
+    throw new Error(`An error occurred: ${message}`);
   }
 }
\ No newline at end of file
@@ -20,12 +20,17 @@ export const GET = async ({ request }) => {
             },
         });
     } else {
-        const errorText = await res.text();
-        return new Response(errorText, {
+        // Pass the backend's JSON error envelope through untouched.
+        const headers = {
+            'Content-Type': res.headers.get('Content-Type') ?? 'application/json',
+        };
+        for (const name of ['Retry-After', 'X-Request-ID']) {
+            const value = res.headers.get(name);
+            if (value) headers[name] = value;
+        }
+        return new Response(await res.text(), {
             status: res.status,
-            headers: {
-                'Content-Type': 'text/plain',
-            },
+            headers,
         });
     }
 